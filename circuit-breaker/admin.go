@@ -0,0 +1,95 @@
+package cb
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// AdminHandler is an http.Handler which lists the circuit breakers of a registry and overrides their states.
+// GET / responds the names and the metrics of the circuit breakers as JSON.
+// POST /{name}/{action} applies one of the force-open, force-closed, disable and reset actions to the named circuit breaker.
+type AdminHandler struct {
+	registry *Registry
+}
+
+// compile time proof of interface implementation
+var _ http.Handler = (*AdminHandler)(nil)
+
+// breakerStatus is the JSON representation of a circuit breaker
+type breakerStatus struct {
+	Name string `json:"name"`
+	Metrics
+}
+
+// NewAdminHandler creates and returns a new admin handler
+func NewAdminHandler(registry *Registry) *AdminHandler {
+	return &AdminHandler{registry: registry}
+}
+
+// ServeHTTP lists the circuit breakers or applies an action to a circuit breaker
+func (h *AdminHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := strings.Trim(r.URL.Path, "/")
+
+	switch {
+	case r.Method == http.MethodGet && path == "":
+		h.list(w)
+	case r.Method == http.MethodPost && path != "":
+		h.apply(w, path)
+	default:
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+	}
+}
+
+// list writes the statuses of the circuit breakers
+func (h *AdminHandler) list(w http.ResponseWriter) {
+	names := h.registry.List()
+
+	statuses := make([]breakerStatus, 0, len(names))
+	for _, name := range names {
+		cb, ok := h.registry.lookup(name)
+		if !ok {
+			continue
+		}
+
+		statuses = append(statuses, breakerStatus{
+			Name:    name,
+			Metrics: cb.Metrics(),
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(statuses)
+}
+
+// apply applies the action in the path to the circuit breaker in the path
+func (h *AdminHandler) apply(w http.ResponseWriter, path string) {
+	i := strings.LastIndex(path, "/")
+	if i < 0 {
+		http.Error(w, "path must be /{name}/{action}", http.StatusBadRequest)
+		return
+	}
+	name, action := path[:i], path[i+1:]
+
+	cb, ok := h.registry.lookup(name)
+	if !ok {
+		http.Error(w, "circuit breaker not found", http.StatusNotFound)
+		return
+	}
+
+	switch action {
+	case "force-open":
+		cb.ForceOpen()
+	case "force-closed":
+		cb.ForceClosed()
+	case "disable":
+		cb.Disable()
+	case "reset":
+		cb.Reset()
+	default:
+		http.Error(w, "unknown action", http.StatusBadRequest)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
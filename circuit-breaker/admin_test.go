@@ -0,0 +1,56 @@
+package cb
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAdminHandler(t *testing.T) {
+	r := NewRegistry(RegistryConfig{Defaults: Config{Threshold: 5, Timeout: 10}})
+	defer r.Stop()
+
+	cb := r.Get("db")
+	h := NewAdminHandler(r)
+
+	// the force-open action must trip the circuit breaker into the forced open state and reject calls
+	t.Run("force open", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/db/force-open", nil))
+		assert.Equal(t, http.StatusNoContent, w.Code)
+		assert.Equal(t, StateForcedOpen, cb.State())
+		assert.ErrorIs(t, cb.Execute(func() error { return nil }), ErrOpenState)
+	})
+
+	// the circuit breakers should be listed with their states
+	t.Run("list", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var statuses []breakerStatus
+		assert.NoError(t, json.NewDecoder(w.Body).Decode(&statuses))
+		assert.Len(t, statuses, 1)
+		assert.Equal(t, "db", statuses[0].Name)
+		assert.Equal(t, StateForcedOpen, statuses[0].State)
+		assert.Equal(t, uint64(1), statuses[0].RejectedCalls)
+	})
+
+	// the reset action must trip the circuit breaker back into the closed state
+	t.Run("reset", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/db/reset", nil))
+		assert.Equal(t, http.StatusNoContent, w.Code)
+		assert.Equal(t, StateClosed, cb.State())
+	})
+
+	// actions on unknown circuit breakers should be rejected
+	t.Run("unknown circuit breaker", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/cache/disable", nil))
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+}
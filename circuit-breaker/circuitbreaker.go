@@ -1,28 +1,73 @@
 package cb
 
 import (
+	"context"
+	"errors"
+	"math"
+	"math/rand"
+	"sync"
 	"time"
 )
 
-// states of the circuit breaker
+// Outcome is the classification of a call's error
+type Outcome int
+
+// outcomes of the calls
 const (
-	StateClosed = iota
-	StateHalfOpen
-	StateOpen
+	OutcomeFailure Outcome = iota
+	OutcomeSuccess
+	OutcomeIgnored
 )
 
+// ErrOpenState is returned by Execute when the circuit breaker rejects a call at the open or the forced open state
+var ErrOpenState = errors.New("circuit breaker is open")
+
 // CircuitBreaker represents circuit breaker
 // Threshold is the failure threshold in failures per second
 // Timeout is the reset timeout in seconds which is useful for tripping the circuit breaker to the half-open state
+// MaxTimeout enables exponential backoff when it is positive, the timeout doubles with each consecutive failed half-open probe up to MaxTimeout seconds
+// Jitter is the random fraction in [0, 1] added to or subtracted from each timeout to spread probes of many clients
+// Classifier classifies errors as failures, successes or ignored errors, DefaultClassifier is used if it is nil
+// SlowCallDuration is the duration above which calls made with Execute are slow, zero disables the slow call detection
+// SlowCallThreshold is the slow call threshold in the rate of slow calls to all calls per second in [0, 1]
+// Fallback is called by Execute with ErrOpenState on rejected calls and with the errors of failed calls if it is not nil, its error is returned instead
+// Name is the name of the circuit breaker in the store
+// Store shares the state and the counts with the circuit breakers of the same name in other processes if it is not nil
 type CircuitBreaker struct {
-	Threshold    int
-	Timeout      int
-	state        int
-	fails        chan error
-	failureCount int
-	openDuration int
-	ticker       *time.Ticker
-	stop         chan struct{}
+	Threshold         int
+	Timeout           int
+	MaxTimeout        int
+	Jitter            float64
+	Classifier        func(error) Outcome
+	SlowCallDuration  time.Duration
+	SlowCallThreshold float64
+	Fallback          func(err error) error
+	Name              string
+	Store             Store
+	mutex             sync.RWMutex
+	state             State
+	since             time.Time
+	entered           time.Time
+	metrics           Metrics
+	results           chan result
+	callCount         int
+	failureCount      int
+	slowCallCount     int
+	failedProbes      int
+	openDuration      int
+	openTimeout       int
+	ticker            *time.Ticker
+	stop              chan struct{}
+	resets            int
+	unsaved           *Record
+	saves             chan struct{}
+	running           sync.WaitGroup
+}
+
+// result is the classified result of a call
+type result struct {
+	outcome Outcome
+	slow    bool
 }
 
 // NewCircuitBreaker creates and returns a new circuit breaker
@@ -33,62 +78,63 @@ func NewCircuitBreaker(threshold, timeout int) *CircuitBreaker {
 	}
 }
 
+// DefaultClassifier classifies nil errors as successes and all other errors as failures
+func DefaultClassifier(err error) Outcome {
+	if err == nil {
+		return OutcomeSuccess
+	}
+
+	return OutcomeFailure
+}
+
+// IgnoreCanceled classifies context cancellations as ignored errors and the rest like DefaultClassifier does
+func IgnoreCanceled(err error) Outcome {
+	if errors.Is(err, context.Canceled) {
+		return OutcomeIgnored
+	}
+
+	return DefaultClassifier(err)
+}
+
 // Start starts the circuit breaker
+// the results are handled by one goroutine and the ticks and the store operations by another one so a slow store doesn't block the calls
 func (cb *CircuitBreaker) Start() {
-	cb.fails = make(chan error)
+	cb.results = make(chan result)
+	cb.saves = make(chan struct{}, 1)
 	cb.ticker = time.NewTicker(time.Second)
 	cb.stop = make(chan struct{})
 
+	cb.mutex.Lock()
+	cb.entered = time.Now()
+	cb.mutex.Unlock()
+
+	cb.running.Add(2)
 	go func() {
-		defer close(cb.stop)
+		defer cb.running.Done()
+		for {
+			select {
+			case r := <-cb.results:
+				cb.mutex.Lock()
+				cb.handle(r)
+				cb.mutex.Unlock()
+			case <-cb.stop:
+				return
+			}
+		}
+	}()
+
+	go func() {
+		defer cb.running.Done()
 		for {
 			select {
-			case err := <-cb.fails:
-				// ignore errors at the open state
-				if cb.state == StateOpen {
-					continue
-				}
-
-				// trip the circuit braker into the closed state on nil errors at the half-open state
-				if cb.state == StateHalfOpen {
-					if err == nil {
-						cb.state = StateClosed
-					}
-					continue
-				}
-
-				// do nothing on nil errors at the closed state
-				if err == nil {
-					continue
-				}
-
-				// increment the fail count on errors at the closed state
-				cb.failureCount++
 			case <-cb.ticker.C:
-				// do nothing at the half-open state on each tick
-				if cb.state == StateHalfOpen {
-					continue
-				}
-
-				// increment the open duration at the open state and trip the circuit breaker into the half-open state on each tick
-				if cb.state == StateOpen {
-					cb.openDuration++
-
-					if cb.openDuration == cb.Timeout {
-						cb.state = StateHalfOpen
-					}
-
-					continue
-				}
-
-				// if the fail count reaches the threshold trip the circuit breaker into the open state and reset the open duration at the closed state on each tick
-				if cb.failureCount >= cb.Threshold {
-					cb.state = StateOpen
-					cb.openDuration = 0
-				}
-
-				// reset the fail count at the closed state on each tick
-				cb.failureCount = 0
+				cb.sync()
+				cb.mutex.Lock()
+				cb.tick()
+				cb.mutex.Unlock()
+				cb.save()
+			case <-cb.saves:
+				cb.save()
 			case <-cb.stop:
 				return
 			}
@@ -100,21 +146,393 @@ func (cb *CircuitBreaker) Start() {
 func (cb *CircuitBreaker) Stop() {
 	cb.ticker.Stop()
 
-	cb.stop <- struct{}{}
-	<-cb.stop
+	close(cb.stop)
+	cb.running.Wait()
 
-	cb.state = StateClosed
-	cb.failureCount = 0
+	cb.mutex.Lock()
+	cb.transition(StateClosed)
+	cb.resetCounts()
+	cb.failedProbes = 0
+	cb.mutex.Unlock()
 
-	close(cb.fails)
+	close(cb.results)
 }
 
 // Fail notifies the circuit breaker
 func (cb *CircuitBreaker) Fail(err error) {
-	cb.fails <- err
+	cb.record(err, 0, false)
+}
+
+// Execute calls fn if the circuit breaker is not open and notifies the circuit breaker with fn's error and duration.
+// Execute returns ErrOpenState without calling fn at the open and the forced open states.
+// Execute returns the fallback's error instead on rejected and failed calls if Fallback is not nil.
+func (cb *CircuitBreaker) Execute(fn func() error) error {
+	failed, err := cb.execute(fn, nil)
+	if failed {
+		return cb.fallback(err)
+	}
+
+	return err
+}
+
+// execute calls fn like Execute without the fallback and reports whether the call is rejected or failed.
+// execute ignores fn's error instead of classifying it if ignore is not nil and reports true.
+func (cb *CircuitBreaker) execute(fn func() error, ignore func() bool) (bool, error) {
+	if cb.reject() {
+		return true, ErrOpenState
+	}
+
+	start := time.Now()
+	err := fn()
+	outcome := cb.record(err, time.Since(start), ignore != nil && ignore())
+
+	return outcome == OutcomeFailure, err
+}
+
+// reject reports whether the circuit breaker rejects calls and counts the rejection
+func (cb *CircuitBreaker) reject() bool {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+
+	if cb.state != StateOpen && cb.state != StateForcedOpen {
+		return false
+	}
+
+	cb.metrics.RejectedCalls++
+
+	return true
+}
+
+// fallback calls the fallback with the rejection or the failure reason if there is any
+func (cb *CircuitBreaker) fallback(err error) error {
+	cb.mutex.RLock()
+	fallback := cb.Fallback
+	cb.mutex.RUnlock()
+
+	if fallback == nil {
+		return err
+	}
+
+	return fallback(err)
 }
 
 // State returns the state of the circuit breaker
-func (cb *CircuitBreaker) State() int {
+func (cb *CircuitBreaker) State() State {
+	cb.mutex.RLock()
+	defer cb.mutex.RUnlock()
+
 	return cb.state
 }
+
+// ForceOpen trips the circuit breaker into the forced open state until another override or Reset
+func (cb *CircuitBreaker) ForceOpen() {
+	cb.override(StateForcedOpen)
+}
+
+// ForceClosed trips the circuit breaker into the forced closed state until another override or Reset
+func (cb *CircuitBreaker) ForceClosed() {
+	cb.override(StateForcedClosed)
+}
+
+// Disable trips the circuit breaker into the disabled state until another override or Reset
+func (cb *CircuitBreaker) Disable() {
+	cb.override(StateDisabled)
+}
+
+// Reset trips the circuit breaker into the closed state and resets the counts and the backoff
+func (cb *CircuitBreaker) Reset() {
+	cb.override(StateClosed)
+}
+
+// override resets the counts and the backoff and trips the circuit breaker into the state
+func (cb *CircuitBreaker) override(state State) {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+
+	cb.resetCounts()
+	cb.failedProbes = 0
+	cb.setState(state)
+}
+
+// configure applies the configuration to the circuit breaker
+func (cb *CircuitBreaker) configure(c Config) {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+
+	cb.Threshold = c.Threshold
+	cb.Timeout = c.Timeout
+	cb.MaxTimeout = c.MaxTimeout
+	cb.Jitter = c.Jitter
+	cb.SlowCallDuration = time.Duration(c.SlowCallDuration)
+	cb.SlowCallThreshold = c.SlowCallThreshold
+}
+
+// record classifies the error and the duration of a call, sends the result to the circuit breaker and returns the outcome
+// the error isn't classified and the outcome is OutcomeIgnored if ignored is true
+func (cb *CircuitBreaker) record(err error, duration time.Duration, ignored bool) Outcome {
+	cb.mutex.RLock()
+	classifier := cb.Classifier
+	slowCallDuration := cb.SlowCallDuration
+	cb.mutex.RUnlock()
+
+	if classifier == nil {
+		classifier = DefaultClassifier
+	}
+
+	outcome := OutcomeIgnored
+	if !ignored {
+		outcome = classifier(err)
+	}
+	cb.results <- result{
+		outcome: outcome,
+		slow:    slowCallDuration > 0 && duration >= slowCallDuration,
+	}
+
+	return outcome
+}
+
+// handle updates the circuit breaker with the result of a call
+func (cb *CircuitBreaker) handle(r result) {
+	cb.count(r)
+
+	// ignore results at the open, the forced open and the disabled states and ignored errors at any state
+	if cb.state == StateOpen || cb.state == StateForcedOpen || cb.state == StateDisabled || r.outcome == OutcomeIgnored {
+		return
+	}
+
+	// trip the circuit braker into the closed state and reset the backoff on successes at the half-open state
+	if cb.state == StateHalfOpen {
+		if r.outcome == OutcomeSuccess {
+			cb.failedProbes = 0
+			cb.setState(StateClosed)
+			return
+		}
+
+		// trip the circuit breaker back into the open state with a longer timeout on failures at the half-open state if the backoff is enabled
+		if cb.MaxTimeout > 0 {
+			cb.failedProbes++
+			cb.open()
+		}
+		return
+	}
+
+	// increment the call count, the slow call count on slow calls and the failure count on failures at the closed and the forced closed states
+	cb.callCount++
+
+	if r.slow {
+		cb.slowCallCount++
+	}
+
+	if r.outcome == OutcomeFailure {
+		cb.failureCount++
+	}
+}
+
+// count adds the result to the metrics at all states except the disabled state
+func (cb *CircuitBreaker) count(r result) {
+	if cb.state == StateDisabled {
+		return
+	}
+
+	switch r.outcome {
+	case OutcomeSuccess:
+		cb.metrics.SuccessfulCalls++
+	case OutcomeFailure:
+		cb.metrics.FailedCalls++
+	case OutcomeIgnored:
+		cb.metrics.IgnoredCalls++
+	}
+
+	if r.slow {
+		cb.metrics.SlowCalls++
+	}
+}
+
+// tick updates the circuit breaker every second
+func (cb *CircuitBreaker) tick() {
+	// do nothing at the half-open state on each tick
+	if cb.state == StateHalfOpen {
+		return
+	}
+
+	// reset the counts without tripping the circuit breaker at the overridden states on each tick
+	if cb.state == StateForcedOpen || cb.state == StateForcedClosed || cb.state == StateDisabled {
+		cb.resetCounts()
+		return
+	}
+
+	// increment the open duration at the open state and trip the circuit breaker into the half-open state on each tick
+	if cb.state == StateOpen {
+		cb.openDuration++
+
+		if cb.openDuration >= cb.openTimeout {
+			cb.setState(StateHalfOpen)
+		}
+
+		return
+	}
+
+	// keep the failure rate of the last second at the closed state on each tick
+	cb.metrics.FailureRate = 0
+	if cb.callCount > 0 {
+		cb.metrics.FailureRate = float64(cb.failureCount) / float64(cb.callCount)
+	}
+
+	// if the fail count or the slow call rate reaches its threshold trip the circuit breaker into the open state at the closed state on each tick
+	if cb.failureCount >= cb.Threshold || cb.slowCallRateExceeded() {
+		cb.open()
+	}
+
+	// reset the counts at the closed state on each tick
+	cb.resetCounts()
+}
+
+// resetCounts resets the counts of the current second
+func (cb *CircuitBreaker) resetCounts() {
+	cb.resets++
+	cb.callCount = 0
+	cb.failureCount = 0
+	cb.slowCallCount = 0
+}
+
+// slowCallRateExceeded reports whether the rate of slow calls reaches the slow call threshold
+func (cb *CircuitBreaker) slowCallRateExceeded() bool {
+	if cb.SlowCallDuration <= 0 || cb.SlowCallThreshold <= 0 || cb.callCount == 0 {
+		return false
+	}
+
+	return float64(cb.slowCallCount)/float64(cb.callCount) >= cb.SlowCallThreshold
+}
+
+// open trips the circuit breaker into the open state and resets the open duration
+func (cb *CircuitBreaker) open() {
+	cb.openDuration = 0
+	cb.openTimeout = cb.timeout()
+	cb.setState(StateOpen)
+}
+
+// setState changes the state of the circuit breaker and schedules saving the change to the store
+func (cb *CircuitBreaker) setState(state State) {
+	cb.transition(state)
+	cb.since = time.Now()
+
+	if cb.Store == nil {
+		return
+	}
+
+	cb.unsaved = &Record{
+		State:        cb.state,
+		Since:        cb.since,
+		Timeout:      cb.openTimeout,
+		FailedProbes: cb.failedProbes,
+	}
+
+	select {
+	case cb.saves <- struct{}{}:
+	default:
+	}
+}
+
+// save saves the last state change to the store, save is called by the ticking goroutine without the mutex so the store doesn't block the calls
+func (cb *CircuitBreaker) save() {
+	cb.mutex.Lock()
+	record := cb.unsaved
+	cb.unsaved = nil
+	cb.mutex.Unlock()
+
+	if record == nil {
+		return
+	}
+
+	// the circuit breaker keeps working locally if the store fails
+	_ = cb.Store.Save(cb.Name, *record)
+}
+
+// transition changes the state of the circuit breaker and adds the time spent in the previous state to the metrics
+func (cb *CircuitBreaker) transition(state State) {
+	now := time.Now()
+
+	if !cb.entered.IsZero() {
+		if cb.metrics.StateDurations == nil {
+			cb.metrics.StateDurations = make(map[State]Duration)
+		}
+		cb.metrics.StateDurations[cb.state] += Duration(now.Sub(cb.entered))
+	}
+
+	cb.state = state
+	cb.entered = now
+}
+
+// sync adopts the state changes of other processes from the store and replaces the counts with the shared counts at the closed state
+// sync is called by the ticking goroutine without the mutex, it holds the mutex only while reading and updating the circuit breaker so the store doesn't block the calls
+func (cb *CircuitBreaker) sync() {
+	if cb.Store == nil {
+		return
+	}
+
+	record, err := cb.Store.Load(cb.Name)
+
+	cb.mutex.Lock()
+
+	// adopt the record if another process changed the state after this process did
+	if err == nil && record.Since.After(cb.since) {
+		cb.transition(record.State)
+		cb.since = record.Since
+		cb.failedProbes = record.FailedProbes
+		cb.openTimeout = record.Timeout
+		cb.openDuration = int(time.Since(record.Since) / time.Second)
+	}
+
+	if cb.state != StateClosed {
+		cb.mutex.Unlock()
+		return
+	}
+
+	counts := Counts{
+		Calls:     cb.callCount,
+		Failures:  cb.failureCount,
+		SlowCalls: cb.slowCallCount,
+	}
+	resets := cb.resets
+	cb.mutex.Unlock()
+
+	// add the counts of this process to the shared counts of the current second
+	sums, err := cb.Store.Add(cb.Name, time.Now().Unix(), counts)
+	if err != nil {
+		return
+	}
+
+	// keep the counts of the results handled in the meantime unless the counts are reset
+	cb.mutex.Lock()
+	if cb.state == StateClosed && cb.resets == resets {
+		cb.callCount += sums.Calls - counts.Calls
+		cb.failureCount += sums.Failures - counts.Failures
+		cb.slowCallCount += sums.SlowCalls - counts.SlowCalls
+	}
+	cb.mutex.Unlock()
+}
+
+// timeout returns the open state timeout in seconds.
+// timeout doubles the base timeout for each consecutive failed probe and caps it at MaxTimeout if the backoff is enabled.
+// timeout rounds the jittered timeout up to whole seconds since the circuit breaker ticks every second.
+func (cb *CircuitBreaker) timeout() int {
+	timeout := float64(cb.Timeout)
+
+	if cb.MaxTimeout > 0 {
+		timeout = math.Min(timeout*math.Pow(2, float64(cb.failedProbes)), float64(cb.MaxTimeout))
+	}
+
+	if cb.Jitter > 0 {
+		timeout *= 1 + cb.Jitter*(2*rand.Float64()-1)
+	}
+
+	if cb.MaxTimeout > 0 {
+		timeout = math.Min(timeout, float64(cb.MaxTimeout))
+	}
+
+	if timeout < 1 {
+		return 1
+	}
+
+	return int(math.Ceil(timeout))
+}
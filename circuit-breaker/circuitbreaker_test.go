@@ -1,6 +1,7 @@
 package cb
 
 import (
+	"context"
 	"errors"
 	"testing"
 	"time"
@@ -61,3 +62,88 @@ func Test(t *testing.T) {
 
 	cb.Stop()
 }
+
+func TestBackoff(t *testing.T) {
+	cb := NewCircuitBreaker(2, 3)
+	cb.MaxTimeout = 20
+
+	// the open state timeout should double with each consecutive failed probe up to the max timeout
+	for failedProbes, expected := range []int{3, 6, 12, 20, 20} {
+		cb.failedProbes = failedProbes
+		assert.Equal(t, expected, cb.timeout())
+	}
+
+	// the jittered timeout should stay within the jitter fraction and the max timeout
+	cb.Jitter = 0.5
+	for failedProbes := 0; failedProbes < 10; failedProbes++ {
+		cb.failedProbes = failedProbes
+		timeout := cb.timeout()
+		assert.GreaterOrEqual(t, timeout, 1)
+		assert.LessOrEqual(t, timeout, cb.MaxTimeout)
+	}
+}
+
+func TestClassification(t *testing.T) {
+	cb := NewCircuitBreaker(1, 3)
+	cb.Classifier = IgnoreCanceled
+	cb.SlowCallDuration = 10 * time.Millisecond
+	cb.SlowCallThreshold = 0.5
+	cb.Start()
+	defer cb.Stop()
+
+	// ignored errors shouldn't trip the circuit breaker into the open state
+	t.Run("ignored errors in the closed state", func(t *testing.T) {
+		err := cb.Execute(func() error {
+			return context.Canceled
+		})
+		assert.ErrorIs(t, err, context.Canceled)
+		time.Sleep(1 * time.Second)
+		assert.Equal(t, StateClosed, cb.State())
+	})
+
+	// slow calls over the slow call threshold must trip the circuit breaker into the open state
+	t.Run("slow calls over the threshold in the closed state", func(t *testing.T) {
+		err := cb.Execute(func() error {
+			time.Sleep(20 * time.Millisecond)
+			return nil
+		})
+		assert.NoError(t, err)
+		time.Sleep(1 * time.Second)
+		assert.Equal(t, StateOpen, cb.State())
+	})
+
+	// calls in the open state must be rejected
+	t.Run("calls in the open state", func(t *testing.T) {
+		err := cb.Execute(func() error {
+			t.Error("rejected call shouldn't be called")
+			return nil
+		})
+		assert.ErrorIs(t, err, ErrOpenState)
+	})
+}
+
+func TestFallback(t *testing.T) {
+	cb := NewCircuitBreaker(1, 10)
+
+	var reasons []error
+	cb.Fallback = func(err error) error {
+		reasons = append(reasons, err)
+		return nil
+	}
+
+	cb.Start()
+	defer cb.Stop()
+
+	err := errors.New("sample error")
+
+	// the fallback should replace the error of a failed call
+	assert.NoError(t, cb.Execute(func() error { return err }))
+
+	// the fallback should replace the rejection at the open state
+	assert.Eventually(t, func() bool {
+		return cb.State() == StateOpen
+	}, 2*time.Second, 10*time.Millisecond)
+	assert.NoError(t, cb.Execute(func() error { return nil }))
+
+	assert.Equal(t, []error{err, ErrOpenState}, reasons)
+}
@@ -0,0 +1,118 @@
+package cb
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Metrics is a snapshot of the metrics of a circuit breaker
+// SlowCalls are counted in addition to the successful and the failed calls
+// StateDurations are the total durations spent in the states since the circuit breaker is started
+// FailureRate is the rate of failed calls to all calls in the last second at the closed state
+type Metrics struct {
+	State           State              `json:"state"`
+	SuccessfulCalls uint64             `json:"successfulCalls"`
+	FailedCalls     uint64             `json:"failedCalls"`
+	IgnoredCalls    uint64             `json:"ignoredCalls"`
+	SlowCalls       uint64             `json:"slowCalls"`
+	RejectedCalls   uint64             `json:"rejectedCalls"`
+	StateDurations  map[State]Duration `json:"stateDurations"`
+	FailureRate     float64            `json:"failureRate"`
+}
+
+// Metrics returns a snapshot of the metrics of the circuit breaker
+func (cb *CircuitBreaker) Metrics() Metrics {
+	cb.mutex.RLock()
+	defer cb.mutex.RUnlock()
+
+	m := cb.metrics
+	m.State = cb.state
+
+	// copy the durations and add the time spent in the current state
+	m.StateDurations = make(map[State]Duration, len(stateNames))
+	for state, d := range cb.metrics.StateDurations {
+		m.StateDurations[state] = d
+	}
+	if !cb.entered.IsZero() {
+		m.StateDurations[cb.state] += Duration(time.Since(cb.entered))
+	}
+
+	return m
+}
+
+// labelEscaper escapes label values in the Prometheus text format
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// WritePrometheus writes the metrics of the circuit breakers of the registry in the Prometheus text format
+func WritePrometheus(w io.Writer, r *Registry) error {
+	type sample struct {
+		name    string
+		metrics Metrics
+	}
+
+	var samples []sample
+	for _, name := range r.List() {
+		if cb, ok := r.lookup(name); ok {
+			samples = append(samples, sample{labelEscaper.Replace(name), cb.Metrics()})
+		}
+	}
+
+	var b strings.Builder
+
+	b.WriteString("# HELP circuit_breaker_calls_total Calls of the circuit breaker by outcome.\n")
+	b.WriteString("# TYPE circuit_breaker_calls_total counter\n")
+	for _, s := range samples {
+		fmt.Fprintf(&b, "circuit_breaker_calls_total{name=\"%s\",outcome=\"successful\"} %d\n", s.name, s.metrics.SuccessfulCalls)
+		fmt.Fprintf(&b, "circuit_breaker_calls_total{name=\"%s\",outcome=\"failed\"} %d\n", s.name, s.metrics.FailedCalls)
+		fmt.Fprintf(&b, "circuit_breaker_calls_total{name=\"%s\",outcome=\"ignored\"} %d\n", s.name, s.metrics.IgnoredCalls)
+		fmt.Fprintf(&b, "circuit_breaker_calls_total{name=\"%s\",outcome=\"rejected\"} %d\n", s.name, s.metrics.RejectedCalls)
+	}
+
+	b.WriteString("# HELP circuit_breaker_slow_calls_total Slow calls of the circuit breaker.\n")
+	b.WriteString("# TYPE circuit_breaker_slow_calls_total counter\n")
+	for _, s := range samples {
+		fmt.Fprintf(&b, "circuit_breaker_slow_calls_total{name=\"%s\"} %d\n", s.name, s.metrics.SlowCalls)
+	}
+
+	b.WriteString("# HELP circuit_breaker_state Current state of the circuit breaker, 1 for the current state and 0 for the others.\n")
+	b.WriteString("# TYPE circuit_breaker_state gauge\n")
+	for _, s := range samples {
+		for state := StateClosed; state <= StateDisabled; state++ {
+			value := 0
+			if state == s.metrics.State {
+				value = 1
+			}
+			fmt.Fprintf(&b, "circuit_breaker_state{name=\"%s\",state=\"%s\"} %d\n", s.name, state, value)
+		}
+	}
+
+	b.WriteString("# HELP circuit_breaker_state_seconds_total Time spent by the circuit breaker in each state.\n")
+	b.WriteString("# TYPE circuit_breaker_state_seconds_total counter\n")
+	for _, s := range samples {
+		for state := StateClosed; state <= StateDisabled; state++ {
+			seconds := time.Duration(s.metrics.StateDurations[state]).Seconds()
+			fmt.Fprintf(&b, "circuit_breaker_state_seconds_total{name=\"%s\",state=\"%s\"} %g\n", s.name, state, seconds)
+		}
+	}
+
+	b.WriteString("# HELP circuit_breaker_failure_rate Rate of failed calls to all calls in the last second at the closed state.\n")
+	b.WriteString("# TYPE circuit_breaker_failure_rate gauge\n")
+	for _, s := range samples {
+		fmt.Fprintf(&b, "circuit_breaker_failure_rate{name=\"%s\"} %g\n", s.name, s.metrics.FailureRate)
+	}
+
+	_, err := io.WriteString(w, b.String())
+
+	return err
+}
+
+// NewMetricsHandler creates and returns an http.Handler which serves the metrics of the circuit breakers of the registry in the Prometheus text format
+func NewMetricsHandler(r *Registry) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		WritePrometheus(w, r)
+	})
+}
@@ -0,0 +1,44 @@
+package cb
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetrics(t *testing.T) {
+	r := NewRegistry(RegistryConfig{Defaults: Config{Threshold: 5, Timeout: 10}})
+	defer r.Stop()
+
+	cb := r.Get("db")
+
+	_ = cb.Execute(func() error { return nil })
+	_ = cb.Execute(func() error { return errors.New("sample error") })
+
+	// calls should be counted by their outcomes
+	assert.Eventually(t, func() bool {
+		m := cb.Metrics()
+		return m.SuccessfulCalls == 1 && m.FailedCalls == 1
+	}, time.Second, 10*time.Millisecond)
+
+	cb.ForceOpen()
+	_ = cb.Execute(func() error { return nil })
+
+	m := cb.Metrics()
+	assert.Equal(t, StateForcedOpen, m.State)
+	assert.Equal(t, uint64(1), m.RejectedCalls)
+	assert.Greater(t, m.StateDurations[StateClosed], Duration(0))
+
+	// metrics should be written in the Prometheus text format
+	var b strings.Builder
+	assert.NoError(t, WritePrometheus(&b, r))
+	assert.Contains(t, b.String(), `circuit_breaker_calls_total{name="db",outcome="rejected"} 1`)
+	assert.Contains(t, b.String(), `circuit_breaker_state{name="db",state="forced-open"} 1`)
+
+	// time spent in the current state should grow
+	time.Sleep(10 * time.Millisecond)
+	assert.Greater(t, cb.Metrics().StateDurations[StateForcedOpen], m.StateDurations[StateForcedOpen])
+}
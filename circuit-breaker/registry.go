@@ -0,0 +1,280 @@
+package cb
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Duration is a time.Duration which is encoded as a string like "1.5s" in configuration files
+type Duration time.Duration
+
+// MarshalText encodes the duration as a string
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+// UnmarshalText decodes the duration from a string
+func (d *Duration) UnmarshalText(text []byte) error {
+	duration, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+
+	*d = Duration(duration)
+
+	return nil
+}
+
+// Config is the declarative configuration of a circuit breaker, see CircuitBreaker for the meaning of the fields
+type Config struct {
+	Threshold         int      `json:"threshold" yaml:"threshold"`
+	Timeout           int      `json:"timeout" yaml:"timeout"`
+	MaxTimeout        int      `json:"maxTimeout" yaml:"maxTimeout"`
+	Jitter            float64  `json:"jitter" yaml:"jitter"`
+	SlowCallDuration  Duration `json:"slowCallDuration" yaml:"slowCallDuration"`
+	SlowCallThreshold float64  `json:"slowCallThreshold" yaml:"slowCallThreshold"`
+}
+
+// defaults of the configurations without a threshold or a timeout
+const (
+	defaultThreshold = 5
+	defaultTimeout   = 10
+)
+
+// Override is a per-name override of the defaults, the nil fields are taken from the defaults and the set fields replace them even if they are zero
+type Override struct {
+	Threshold         *int      `json:"threshold" yaml:"threshold"`
+	Timeout           *int      `json:"timeout" yaml:"timeout"`
+	MaxTimeout        *int      `json:"maxTimeout" yaml:"maxTimeout"`
+	Jitter            *float64  `json:"jitter" yaml:"jitter"`
+	SlowCallDuration  *Duration `json:"slowCallDuration" yaml:"slowCallDuration"`
+	SlowCallThreshold *float64  `json:"slowCallThreshold" yaml:"slowCallThreshold"`
+}
+
+// apply returns the configuration whose fields are replaced with the set fields of the override
+func (o Override) apply(c Config) Config {
+	if o.Threshold != nil {
+		c.Threshold = *o.Threshold
+	}
+	if o.Timeout != nil {
+		c.Timeout = *o.Timeout
+	}
+	if o.MaxTimeout != nil {
+		c.MaxTimeout = *o.MaxTimeout
+	}
+	if o.Jitter != nil {
+		c.Jitter = *o.Jitter
+	}
+	if o.SlowCallDuration != nil {
+		c.SlowCallDuration = *o.SlowCallDuration
+	}
+	if o.SlowCallThreshold != nil {
+		c.SlowCallThreshold = *o.SlowCallThreshold
+	}
+
+	return c
+}
+
+// RegistryConfig is the configuration of a registry
+// Defaults is the configuration of the circuit breakers without overrides
+// Breakers are the per-name overrides of the defaults
+// Thresholds and timeouts which are less than 1 are replaced with 5 failures per second and 10 seconds
+type RegistryConfig struct {
+	Defaults Config              `json:"defaults" yaml:"defaults"`
+	Breakers map[string]Override `json:"breakers" yaml:"breakers"`
+}
+
+// config returns the configuration of the named circuit breaker
+func (rc RegistryConfig) config(name string) Config {
+	c := rc.Defaults
+	if o, ok := rc.Breakers[name]; ok {
+		c = o.apply(c)
+	}
+
+	if c.Threshold < 1 {
+		c.Threshold = defaultThreshold
+	}
+	if c.Timeout < 1 {
+		c.Timeout = defaultTimeout
+	}
+
+	return c
+}
+
+// LoadConfig reads a registry configuration from a JSON file or a YAML file depending on the file's extension
+func LoadConfig(path string) (RegistryConfig, error) {
+	var rc RegistryConfig
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return rc, err
+	}
+
+	switch filepath.Ext(path) {
+	case ".json":
+		err = json.Unmarshal(data, &rc)
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &rc)
+	default:
+		err = fmt.Errorf("unsupported configuration file extension %q", filepath.Ext(path))
+	}
+
+	return rc, err
+}
+
+// Registry creates started circuit breakers lazily by name and keeps them
+// OnReloadError is called with the errors of the reloads started by Watch if it is not nil
+// Store is set as the store of the created circuit breakers if it is not nil
+type Registry struct {
+	OnReloadError func(error)
+	Store         Store
+	mutex         sync.Mutex
+	config        RegistryConfig
+	breakers      map[string]*CircuitBreaker
+	stop          chan struct{}
+}
+
+// NewRegistry creates and returns a new registry
+func NewRegistry(config RegistryConfig) *Registry {
+	return &Registry{
+		config:   config,
+		breakers: make(map[string]*CircuitBreaker),
+	}
+}
+
+// Get returns the named circuit breaker, Get creates and starts the circuit breaker on its first call
+func (r *Registry) Get(name string) *CircuitBreaker {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	cb, ok := r.breakers[name]
+	if !ok {
+		cb = &CircuitBreaker{Name: name, Store: r.Store}
+		cb.configure(r.config.config(name))
+		cb.Start()
+		r.breakers[name] = cb
+	}
+
+	return cb
+}
+
+// lookup returns the named circuit breaker if it is created
+func (r *Registry) lookup(name string) (*CircuitBreaker, bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	cb, ok := r.breakers[name]
+
+	return cb, ok
+}
+
+// List returns the sorted names of the created circuit breakers
+func (r *Registry) List() []string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	names := make([]string, 0, len(r.breakers))
+	for name := range r.breakers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// Configure replaces the configuration and applies it to the created circuit breakers
+func (r *Registry) Configure(config RegistryConfig) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.config = config
+	for name, cb := range r.breakers {
+		cb.configure(config.config(name))
+	}
+}
+
+// Watch loads the configuration file and reloads it every interval after the file is modified until the registry is stopped
+func (r *Registry) Watch(path string, interval time.Duration) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	config, err := LoadConfig(path)
+	if err != nil {
+		return err
+	}
+	r.Configure(config)
+
+	r.mutex.Lock()
+	if r.stop == nil {
+		r.stop = make(chan struct{})
+	}
+	stop := r.stop
+	r.mutex.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		modTime := info.ModTime()
+		for {
+			select {
+			case <-ticker.C:
+				info, err := os.Stat(path)
+				if err != nil {
+					r.reloadError(err)
+					continue
+				}
+
+				// do nothing if the file isn't modified since the last reload
+				if info.ModTime().Equal(modTime) {
+					continue
+				}
+				modTime = info.ModTime()
+
+				// keep the current configuration if the modified file is invalid
+				config, err := LoadConfig(path)
+				if err != nil {
+					r.reloadError(err)
+					continue
+				}
+				r.Configure(config)
+			case <-stop:
+				return
+			}
+		}
+	}()
+
+	return nil
+}
+
+// Stop stops watching the configuration file and stops the created circuit breakers
+func (r *Registry) Stop() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.stop != nil {
+		close(r.stop)
+		r.stop = nil
+	}
+
+	for name, cb := range r.breakers {
+		cb.Stop()
+		delete(r.breakers, name)
+	}
+}
+
+// reloadError reports a reload error
+func (r *Registry) reloadError(err error) {
+	if r.OnReloadError != nil {
+		r.OnReloadError(err)
+	}
+}
@@ -0,0 +1,103 @@
+package cb
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
+)
+
+// ptr returns a pointer to the value for the overrides built in code
+func ptr[T any](v T) *T {
+	return &v
+}
+
+func TestRegistryConfig(t *testing.T) {
+	expected := Config{Threshold: 5, Timeout: 30, SlowCallDuration: Duration(time.Second)}
+
+	// overrides should take the missing fields from the defaults in JSON
+	t.Run("json", func(t *testing.T) {
+		var rc RegistryConfig
+		err := json.Unmarshal([]byte(`{"defaults": {"threshold": 5, "timeout": 10, "slowCallDuration": "1s"}, "breakers": {"payments": {"timeout": 30}}}`), &rc)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, rc.config("payments"))
+	})
+
+	// overrides should take the missing fields from the defaults in YAML
+	t.Run("yaml", func(t *testing.T) {
+		var rc RegistryConfig
+		err := yaml.Unmarshal([]byte("defaults:\n  threshold: 5\n  timeout: 10\n  slowCallDuration: 1s\nbreakers:\n  payments:\n    timeout: 30\n"), &rc)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, rc.config("payments"))
+	})
+
+	// overrides should disable the features enabled by the defaults
+	t.Run("disable", func(t *testing.T) {
+		var rc RegistryConfig
+		err := json.Unmarshal([]byte(`{"defaults": {"threshold": 5, "timeout": 10, "maxTimeout": 300, "jitter": 0.2, "slowCallDuration": "1s"}, "breakers": {"payments": {"maxTimeout": 0, "jitter": 0, "slowCallDuration": "0s"}}}`), &rc)
+		assert.NoError(t, err)
+		assert.Equal(t, Config{Threshold: 5, Timeout: 10}, rc.config("payments"))
+	})
+}
+
+func TestRegistry(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "breakers.json")
+	err := os.WriteFile(path, []byte(`{"defaults": {"threshold": 5, "timeout": 10}}`), 0o644)
+	assert.NoError(t, err)
+
+	r := NewRegistry(RegistryConfig{})
+	defer r.Stop()
+
+	err = r.Watch(path, 10*time.Millisecond)
+	assert.NoError(t, err)
+
+	// circuit breakers should be created lazily with the default configuration
+	cb := r.Get("users")
+	assert.Same(t, cb, r.Get("users"))
+	assert.Equal(t, []string{"users"}, r.List())
+	assert.Equal(t, 10, cb.Timeout)
+
+	// overrides in the modified configuration file should be applied to the created circuit breakers
+	err = os.WriteFile(path, []byte(`{"defaults": {"threshold": 5, "timeout": 10}, "breakers": {"users": {"timeout": 20}}}`), 0o644)
+	assert.NoError(t, err)
+	err = os.Chtimes(path, time.Now(), time.Now().Add(time.Second))
+	assert.NoError(t, err)
+
+	assert.Eventually(t, func() bool {
+		cb.mutex.RLock()
+		defer cb.mutex.RUnlock()
+		return cb.Timeout == 20
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestRegistryDefaults(t *testing.T) {
+	r := NewRegistry(RegistryConfig{
+		Defaults: Config{Threshold: 3, MaxTimeout: 60},
+		Breakers: map[string]Override{
+			"payments": {Timeout: ptr(30), MaxTimeout: ptr(0)},
+		},
+	})
+	defer r.Stop()
+
+	// overrides built in code should take the nil fields from the defaults and replace the others
+	cb := r.Get("payments")
+	assert.Equal(t, 3, cb.Threshold)
+	assert.Equal(t, 30, cb.Timeout)
+	assert.Zero(t, cb.MaxTimeout)
+
+	r = NewRegistry(RegistryConfig{})
+	defer r.Stop()
+
+	// missing thresholds and timeouts should be replaced with the built-in defaults
+	cb = r.Get("users")
+	assert.Equal(t, defaultThreshold, cb.Threshold)
+	assert.Equal(t, defaultTimeout, cb.Timeout)
+
+	// circuit breakers without calls shouldn't trip
+	time.Sleep(1100 * time.Millisecond)
+	assert.Equal(t, StateClosed, cb.State())
+}
@@ -0,0 +1,87 @@
+package cb
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// State is the state of a circuit breaker
+type State int
+
+// states of the circuit breaker
+// StateForcedOpen rejects all calls, StateForcedClosed allows all calls and never trips, StateDisabled allows all calls and doesn't count them
+const (
+	StateClosed State = iota
+	StateHalfOpen
+	StateOpen
+	StateForcedOpen
+	StateForcedClosed
+	StateDisabled
+)
+
+// stateNames are the names of the states in logs and APIs
+var stateNames = map[State]string{
+	StateClosed:       "closed",
+	StateHalfOpen:     "half-open",
+	StateOpen:         "open",
+	StateForcedOpen:   "forced-open",
+	StateForcedClosed: "forced-closed",
+	StateDisabled:     "disabled",
+}
+
+// String returns the name of the state
+func (s State) String() string {
+	if name, ok := stateNames[s]; ok {
+		return name
+	}
+
+	return fmt.Sprintf("State(%d)", int(s))
+}
+
+// MarshalText encodes the state as its name
+func (s State) MarshalText() ([]byte, error) {
+	if _, ok := stateNames[s]; !ok {
+		return nil, fmt.Errorf("invalid state %d", int(s))
+	}
+
+	return []byte(s.String()), nil
+}
+
+// UnmarshalText decodes the state from its name
+func (s *State) UnmarshalText(text []byte) error {
+	for state, name := range stateNames {
+		if name == string(text) {
+			*s = state
+			return nil
+		}
+	}
+
+	return fmt.Errorf("invalid state %q", text)
+}
+
+// MarshalJSON encodes the state as a JSON string of its name
+func (s State) MarshalJSON() ([]byte, error) {
+	text, err := s.MarshalText()
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(string(text))
+}
+
+// UnmarshalJSON decodes the state from a JSON string of its name.
+// UnmarshalJSON also accepts the JSON numbers of the files written before the states had names.
+func (s *State) UnmarshalJSON(data []byte) error {
+	var number int
+	if err := json.Unmarshal(data, &number); err == nil {
+		*s = State(number)
+		return nil
+	}
+
+	var text string
+	if err := json.Unmarshal(data, &text); err != nil {
+		return err
+	}
+
+	return s.UnmarshalText([]byte(text))
+}
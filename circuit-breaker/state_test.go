@@ -0,0 +1,26 @@
+package cb
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestState(t *testing.T) {
+	assert.Equal(t, "half-open", StateHalfOpen.String())
+
+	// states should be encoded as their names
+	data, err := json.Marshal(map[string]State{"state": StateForcedOpen})
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"state": "forced-open"}`, string(data))
+
+	// states should be decoded from their names and their numbers
+	var states []State
+	assert.NoError(t, json.Unmarshal([]byte(`["open", 0]`), &states))
+	assert.Equal(t, []State{StateOpen, StateClosed}, states)
+
+	// unknown names should be rejected
+	var s State
+	assert.Error(t, json.Unmarshal([]byte(`"ajar"`), &s))
+}
@@ -0,0 +1,221 @@
+package cb
+
+import (
+	"encoding/json"
+	"errors"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Counts are the counts of the calls of a circuit breaker in a second
+type Counts struct {
+	Calls     int `json:"calls"`
+	Failures  int `json:"failures"`
+	SlowCalls int `json:"slowCalls"`
+}
+
+// Record is the shared state of a circuit breaker
+// Since is the time of the last state change
+// Timeout is the open state timeout in seconds
+type Record struct {
+	State        State     `json:"state"`
+	Since        time.Time `json:"since"`
+	Timeout      int       `json:"timeout"`
+	FailedProbes int       `json:"failedProbes"`
+}
+
+// Store defines the behaviors of a store which shares the states and the counts of circuit breakers.
+// Circuit breakers add their counts to the store and load the records of the other processes every second,
+// the counts are summed by the seconds of the wall clock so the sums are approximate across processes.
+type Store interface {
+	// Add adds the counts to the named circuit breaker's counts of the second and returns the sums
+	Add(name string, second int64, counts Counts) (Counts, error)
+	// Load returns the named circuit breaker's record, Load returns a zero record if there isn't any
+	Load(name string) (Record, error)
+	// Save replaces the named circuit breaker's record
+	Save(name string, record Record) error
+}
+
+// compile time proofs of interface implementations
+var (
+	_ Store = (*MemoryStore)(nil)
+	_ Store = (*FileStore)(nil)
+)
+
+// entry is the stored data of a circuit breaker
+type entry struct {
+	Record Record `json:"record"`
+	Second int64  `json:"second"`
+	Counts Counts `json:"counts"`
+}
+
+// add adds the counts to the counts of the second and resets the counts of the older seconds
+func (e *entry) add(second int64, counts Counts) Counts {
+	if e.Second != second {
+		e.Second = second
+		e.Counts = Counts{}
+	}
+
+	e.Counts.Calls += counts.Calls
+	e.Counts.Failures += counts.Failures
+	e.Counts.SlowCalls += counts.SlowCalls
+
+	return e.Counts
+}
+
+// MemoryStore is a store which shares the states between the circuit breakers of a process
+type MemoryStore struct {
+	mutex   sync.Mutex
+	entries map[string]*entry
+}
+
+// NewMemoryStore creates and returns a new memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		entries: make(map[string]*entry),
+	}
+}
+
+// Add adds the counts to the named circuit breaker's counts of the second and returns the sums
+func (s *MemoryStore) Add(name string, second int64, counts Counts) (Counts, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.entry(name).add(second, counts), nil
+}
+
+// Load returns the named circuit breaker's record
+func (s *MemoryStore) Load(name string) (Record, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.entry(name).Record, nil
+}
+
+// Save replaces the named circuit breaker's record
+func (s *MemoryStore) Save(name string, record Record) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.entry(name).Record = record
+
+	return nil
+}
+
+// entry returns the named circuit breaker's entry and creates it if it doesn't exist
+func (s *MemoryStore) entry(name string) *entry {
+	e, ok := s.entries[name]
+	if !ok {
+		e = &entry{}
+		s.entries[name] = e
+	}
+
+	return e
+}
+
+// errLocked is returned while another process holds the lock of an entry
+var errLocked = errors.New("entry is locked")
+
+// lockRetryInterval is the interval between the attempts to lock an entry
+const lockRetryInterval = 5 * time.Millisecond
+
+// lockTimeout is the duration after which the attempts to lock an entry fail
+const lockTimeout = time.Second
+
+// FileStore is a store which shares the states between the processes of a host through the files of a directory.
+// FileStore keeps each circuit breaker in a JSON file and serializes the updates with lock files,
+// the lock files are locked with flock on Unix systems and created exclusively on the other systems.
+type FileStore struct {
+	dir string
+}
+
+// NewFileStore creates and returns a new file store in the directory, NewFileStore creates the directory if it doesn't exist
+func NewFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	return &FileStore{dir: dir}, nil
+}
+
+// Add adds the counts to the named circuit breaker's counts of the second and returns the sums
+func (s *FileStore) Add(name string, second int64, counts Counts) (Counts, error) {
+	var sums Counts
+	err := s.update(name, func(e *entry) {
+		sums = e.add(second, counts)
+	})
+
+	return sums, err
+}
+
+// Load returns the named circuit breaker's record
+func (s *FileStore) Load(name string) (Record, error) {
+	e, err := s.read(name)
+
+	return e.Record, err
+}
+
+// Save replaces the named circuit breaker's record
+func (s *FileStore) Save(name string, record Record) error {
+	return s.update(name, func(e *entry) {
+		e.Record = record
+	})
+}
+
+// update locks, reads, updates and writes the named circuit breaker's entry
+func (s *FileStore) update(name string, fn func(*entry)) error {
+	unlock, err := s.lock(name)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	e, err := s.read(name)
+	if err != nil {
+		return err
+	}
+
+	fn(&e)
+
+	return s.write(name, e)
+}
+
+// read reads the named circuit breaker's entry, read returns a zero entry if the file doesn't exist
+func (s *FileStore) read(name string) (entry, error) {
+	var e entry
+
+	data, err := os.ReadFile(s.path(name))
+	if errors.Is(err, os.ErrNotExist) {
+		return e, nil
+	}
+	if err != nil {
+		return e, err
+	}
+
+	err = json.Unmarshal(data, &e)
+
+	return e, err
+}
+
+// write writes the named circuit breaker's entry into a temporary file and renames it so readers never see partial files
+func (s *FileStore) write(name string, e entry) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	tmp := s.path(name) + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, s.path(name))
+}
+
+// path returns the path of the named circuit breaker's file
+func (s *FileStore) path(name string) string {
+	return filepath.Join(s.dir, url.PathEscape(name)+".json")
+}
@@ -0,0 +1,44 @@
+//go:build !unix
+
+package cb
+
+import (
+	"errors"
+	"os"
+	"time"
+)
+
+// staleLockAge is the age after which the lock of a crashed process is removed
+const staleLockAge = 10 * time.Second
+
+// lock creates the lock file of the named circuit breaker and returns a function which removes it.
+// The removal of stale locks isn't atomic, two processes which find the same stale lock may both hold the lock.
+func (s *FileStore) lock(name string) (func(), error) {
+	path := s.path(name) + ".lock"
+
+	deadline := time.Now().Add(lockTimeout)
+	for {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+		if err == nil {
+			f.Close()
+			return func() { os.Remove(path) }, nil
+		}
+
+		if !errors.Is(err, os.ErrExist) {
+			return nil, err
+		}
+
+		// remove the lock of a crashed process
+		info, err := os.Stat(path)
+		if err == nil && time.Since(info.ModTime()) > staleLockAge {
+			os.Remove(path)
+			continue
+		}
+
+		if time.Now().After(deadline) {
+			return nil, errLocked
+		}
+
+		time.Sleep(lockRetryInterval)
+	}
+}
@@ -0,0 +1,94 @@
+package cb
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStore(t *testing.T) {
+	fileStore, err := NewFileStore(t.TempDir())
+	assert.NoError(t, err)
+
+	stores := map[string]Store{
+		"memory": NewMemoryStore(),
+		"file":   fileStore,
+	}
+
+	for name, store := range stores {
+		// a trip in one circuit breaker should be seen by the other circuit breakers of the same name
+		t.Run(name, func(t *testing.T) {
+			cb1 := &CircuitBreaker{Threshold: 1, Timeout: 10, Name: "db", Store: store}
+			cb2 := &CircuitBreaker{Threshold: 1, Timeout: 10, Name: "db", Store: store}
+			cb1.Start()
+			cb2.Start()
+			defer cb1.Stop()
+			defer cb2.Stop()
+
+			cb1.Fail(errors.New("sample error"))
+
+			assert.Eventually(t, func() bool {
+				return cb2.State() == StateOpen
+			}, 3*time.Second, 100*time.Millisecond)
+		})
+	}
+}
+
+func TestFileStoreLock(t *testing.T) {
+	dir := t.TempDir()
+
+	// concurrent updates of the stores of the same directory should be serialized
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		store, err := NewFileStore(dir)
+		assert.NoError(t, err)
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 25; j++ {
+				_, err := store.Add("db", 1, Counts{Calls: 1})
+				assert.NoError(t, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	store, err := NewFileStore(dir)
+	assert.NoError(t, err)
+	sums, err := store.Add("db", 1, Counts{})
+	assert.NoError(t, err)
+	assert.Equal(t, 100, sums.Calls)
+}
+
+// slowStore is a store whose operations are delayed like a contended file store
+type slowStore struct {
+	*MemoryStore
+	delay time.Duration
+}
+
+func (s slowStore) Add(name string, second int64, counts Counts) (Counts, error) {
+	time.Sleep(s.delay)
+	return s.MemoryStore.Add(name, second, counts)
+}
+
+func (s slowStore) Load(name string) (Record, error) {
+	time.Sleep(s.delay)
+	return s.MemoryStore.Load(name)
+}
+
+func TestSlowStore(t *testing.T) {
+	cb := &CircuitBreaker{Threshold: 5, Timeout: 10, Name: "db", Store: slowStore{NewMemoryStore(), 500 * time.Millisecond}}
+	cb.Start()
+	defer cb.Stop()
+
+	// calls shouldn't wait for the store while the circuit breaker syncs with it
+	time.Sleep(1200 * time.Millisecond)
+	start := time.Now()
+	err := cb.Execute(func() error { return nil })
+	assert.NoError(t, err)
+	assert.Less(t, time.Since(start), 100*time.Millisecond)
+}
@@ -0,0 +1,42 @@
+//go:build unix
+
+package cb
+
+import (
+	"errors"
+	"os"
+	"syscall"
+	"time"
+)
+
+// lock locks the lock file of the named circuit breaker with flock and returns a function which unlocks it.
+// The operating system releases the locks of crashed processes so there aren't any stale locks.
+func (s *FileStore) lock(name string) (func(), error) {
+	f, err := os.OpenFile(s.path(name)+".lock", os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, err
+	}
+
+	deadline := time.Now().Add(lockTimeout)
+	for {
+		err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+		if err == nil {
+			return func() {
+				syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+				f.Close()
+			}, nil
+		}
+
+		if !errors.Is(err, syscall.EWOULDBLOCK) {
+			f.Close()
+			return nil, err
+		}
+
+		if time.Now().After(deadline) {
+			f.Close()
+			return nil, errLocked
+		}
+
+		time.Sleep(lockRetryInterval)
+	}
+}
@@ -0,0 +1,146 @@
+package cb
+
+import (
+	"errors"
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// Breaker defines the common behavior of the circuit breaker and the adaptive throttle
+type Breaker interface {
+	Execute(fn func() error) error
+}
+
+// compile time proofs of interface implementations
+var (
+	_ Breaker = (*CircuitBreaker)(nil)
+	_ Breaker = (*Throttle)(nil)
+)
+
+// ErrThrottled is returned by Execute when the throttle rejects a call locally
+var ErrThrottled = errors.New("request is throttled")
+
+// Throttle is the client-side adaptive throttle of the Google SRE book.
+// Throttle rejects calls locally with the probability max(0, (requests - K*accepts) / (requests + 1)) over the window.
+// K is the multiplier of the accepts, lower values throttle more aggressively, 2 is a good default
+// Window is the duration of the history of requests and accepts
+// Classifier classifies errors as failures, successes or ignored errors, DefaultClassifier is used if it is nil
+// Fallback is called by Execute with ErrThrottled on rejected calls and with the errors of failed calls if it is not nil, its error is returned instead
+type Throttle struct {
+	K          float64
+	Window     time.Duration
+	Classifier func(error) Outcome
+	Fallback   func(err error) error
+	mutex      sync.Mutex
+	buckets    []throttleBucket
+}
+
+// throttleBucket keeps the requests and the accepts of a second in the window
+type throttleBucket struct {
+	second   int64
+	requests int
+	accepts  int
+}
+
+// NewThrottle creates and returns a new throttle
+func NewThrottle(k float64, window time.Duration) *Throttle {
+	return &Throttle{
+		K:      k,
+		Window: window,
+	}
+}
+
+// Execute calls fn unless the throttle rejects the call and records whether the backend accepts the call.
+// Execute returns ErrThrottled without calling fn if the throttle rejects the call.
+// Execute returns the fallback's error instead on rejected and failed calls if Fallback is not nil.
+func (t *Throttle) Execute(fn func() error) error {
+	if rand.Float64() < t.RejectionProbability() {
+		t.record(false)
+		return t.fallback(ErrThrottled)
+	}
+
+	err := fn()
+
+	classifier := t.Classifier
+	if classifier == nil {
+		classifier = DefaultClassifier
+	}
+
+	switch classifier(err) {
+	case OutcomeSuccess:
+		t.record(true)
+	case OutcomeFailure:
+		t.record(false)
+		return t.fallback(err)
+	}
+
+	return err
+}
+
+// fallback calls the fallback with the rejection or the failure reason if there is any
+func (t *Throttle) fallback(err error) error {
+	if t.Fallback == nil {
+		return err
+	}
+
+	return t.Fallback(err)
+}
+
+// RejectionProbability returns the current probability of rejecting a call locally
+func (t *Throttle) RejectionProbability() float64 {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	requests, accepts := t.counts(time.Now())
+
+	return math.Max(0, (float64(requests)-t.K*float64(accepts))/float64(requests+1))
+}
+
+// record records a request and whether the request is accepted
+func (t *Throttle) record(accepted bool) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	b := t.bucket(time.Now())
+	b.requests++
+	if accepted {
+		b.accepts++
+	}
+}
+
+// bucket returns the bucket of the current second and drops the buckets out of the window
+func (t *Throttle) bucket(now time.Time) *throttleBucket {
+	t.expire(now)
+
+	second := now.Unix()
+	if len(t.buckets) == 0 || t.buckets[len(t.buckets)-1].second != second {
+		t.buckets = append(t.buckets, throttleBucket{second: second})
+	}
+
+	return &t.buckets[len(t.buckets)-1]
+}
+
+// counts returns the requests and the accepts in the window
+func (t *Throttle) counts(now time.Time) (requests, accepts int) {
+	t.expire(now)
+
+	for _, b := range t.buckets {
+		requests += b.requests
+		accepts += b.accepts
+	}
+
+	return requests, accepts
+}
+
+// expire drops the buckets out of the window
+func (t *Throttle) expire(now time.Time) {
+	oldest := now.Add(-t.Window).Unix()
+
+	i := 0
+	for i < len(t.buckets) && t.buckets[i].second <= oldest {
+		i++
+	}
+	t.buckets = t.buckets[i:]
+}
@@ -0,0 +1,34 @@
+package cb
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestThrottle(t *testing.T) {
+	th := NewThrottle(2, time.Minute)
+	err := errors.New("sample error")
+
+	// the throttle shouldn't reject calls while the backend accepts them
+	for i := 0; i < 100; i++ {
+		assert.NoError(t, th.Execute(func() error { return nil }))
+	}
+	assert.Equal(t, 0.0, th.RejectionProbability())
+
+	// the rejection probability should grow while the backend rejects calls
+	for i := 0; i < 1000; i++ {
+		_ = th.Execute(func() error { return err })
+	}
+	assert.Greater(t, th.RejectionProbability(), 0.5)
+
+	// ignored errors shouldn't be recorded
+	th = NewThrottle(2, time.Minute)
+	th.Classifier = IgnoreCanceled
+	_ = th.Execute(func() error { return context.Canceled })
+	requests, _ := th.counts(time.Now())
+	assert.Equal(t, 0, requests)
+}
@@ -0,0 +1,78 @@
+package cb
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// Transport is an http.RoundTripper which keeps a circuit breaker per destination host.
+// Transport treats transport errors and 5xx responses as failures and rejects requests to the hosts with open circuit breakers.
+// Transport ignores the errors of the requests whose contexts are canceled or expired since they aren't the host's failures.
+type Transport struct {
+	base     http.RoundTripper
+	registry *Registry
+}
+
+// compile time proof of interface implementation
+var _ http.RoundTripper = (*Transport)(nil)
+
+// statusError reports a 5xx response to the circuit breaker
+type statusError struct {
+	statusCode int
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("server error: %s", http.StatusText(e.statusCode))
+}
+
+// NewTransport creates and returns a new transport
+// base is the underlying round tripper, http.DefaultTransport is used if it is nil
+// registry creates the circuit breakers of the hosts by their names
+func NewTransport(base http.RoundTripper, registry *Registry) *Transport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	return &Transport{
+		base:     base,
+		registry: registry,
+	}
+}
+
+// RoundTrip sends the request through the circuit breaker of the request's host.
+// RoundTrip returns an error wrapping ErrOpenState without sending the request if the circuit breaker is open.
+// The fallbacks of the circuit breakers aren't called since a round tripper must return either a response or an error.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	host := req.URL.Host
+	cb := t.registry.Get(host)
+
+	var resp *http.Response
+	_, err := cb.execute(func() error {
+		var err error
+		resp, err = t.base.RoundTrip(req)
+		if err != nil {
+			return err
+		}
+
+		if resp.StatusCode >= http.StatusInternalServerError {
+			return &statusError{resp.StatusCode}
+		}
+
+		return nil
+	}, func() bool {
+		return req.Context().Err() != nil
+	})
+
+	// return 5xx responses to the caller as they are
+	var se *statusError
+	if errors.As(err, &se) {
+		return resp, nil
+	}
+
+	if errors.Is(err, ErrOpenState) {
+		return nil, fmt.Errorf("%s: %w", host, err)
+	}
+
+	return resp, err
+}
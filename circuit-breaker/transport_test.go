@@ -0,0 +1,94 @@
+package cb
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTransport(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	r := NewRegistry(RegistryConfig{Defaults: Config{Threshold: 1, Timeout: 10}})
+	defer r.Stop()
+
+	client := &http.Client{Transport: NewTransport(nil, r)}
+
+	// 5xx responses should be returned as they are
+	resp, err := client.Get(server.URL)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	resp.Body.Close()
+
+	// 5xx responses over the threshold must trip the host's circuit breaker into the open state
+	cb := r.Get(server.Listener.Addr().String())
+	assert.Eventually(t, func() bool {
+		return cb.State() == StateOpen
+	}, 2*time.Second, 10*time.Millisecond)
+
+	_, err = client.Get(server.URL)
+	assert.ErrorIs(t, err, ErrOpenState)
+}
+
+func TestTransportCanceled(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+
+	r := NewRegistry(RegistryConfig{Defaults: Config{Threshold: 1, Timeout: 10}})
+	defer r.Stop()
+
+	client := &http.Client{Transport: NewTransport(nil, r)}
+
+	// requests canceled by the client shouldn't be counted as the host's failures
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+	assert.NoError(t, err)
+	_, err = client.Do(req)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	cb := r.Get(req.URL.Host)
+	assert.Eventually(t, func() bool {
+		return cb.Metrics().IgnoredCalls == 1
+	}, time.Second, 10*time.Millisecond)
+	assert.Zero(t, cb.Metrics().FailedCalls)
+}
+
+func TestTransportFallback(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	r := NewRegistry(RegistryConfig{Defaults: Config{Threshold: 1, Timeout: 10}})
+	defer r.Stop()
+
+	client := &http.Client{Transport: NewTransport(nil, r)}
+
+	// fallbacks shouldn't replace the 5xx responses and the rejections
+	r.Get(server.Listener.Addr().String()).Fallback = func(err error) error {
+		return nil
+	}
+
+	resp, err := client.Get(server.URL)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	resp.Body.Close()
+
+	cb := r.Get(server.Listener.Addr().String())
+	assert.Eventually(t, func() bool {
+		return cb.State() == StateOpen
+	}, 2*time.Second, 10*time.Millisecond)
+
+	_, err = client.Get(server.URL)
+	assert.ErrorIs(t, err, ErrOpenState)
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	pool "github.com/ermanimer/design-patterns/connection-pool"
+)
+
+// strategies are the upstream selection strategies by their flag values
+var strategies = map[string]pool.Strategy{
+	"round-robin":  pool.RoundRobin,
+	"least-in-use": pool.LeastInUse,
+	"power-of-two": pool.PowerOfTwoChoices,
+}
+
+// config is the configuration of the proxy
+type config struct {
+	listen          string
+	admin           string
+	backends        string
+	strategy        string
+	limit           int
+	minIdle         int
+	healthCheck     bool
+	maxFailures     int
+	cooldown        time.Duration
+	dialTimeout     time.Duration
+	shutdownTimeout time.Duration
+}
+
+func main() {
+	var c config
+	flag.StringVar(&c.listen, "listen", "127.0.0.1:8000", "address to accept the client connections")
+	flag.StringVar(&c.admin, "admin", "127.0.0.1:8001", "address of the admin endpoint, empty disables the admin endpoint")
+	flag.StringVar(&c.backends, "backends", "", "comma separated addresses of the backends")
+	flag.StringVar(&c.strategy, "strategy", "round-robin", "upstream selection strategy, one of round-robin, least-in-use and power-of-two")
+	flag.IntVar(&c.limit, "limit", 100, "maximum number of connections per backend")
+	flag.IntVar(&c.minIdle, "min-idle", 2, "number of idle connections kept open per backend")
+	flag.BoolVar(&c.healthCheck, "health-check", true, "check idle backend connections before using them, it needs a positive min idle, disable it for server-first protocols")
+	flag.IntVar(&c.maxFailures, "max-failures", 3, "consecutive failures after which a backend is ejected")
+	flag.DurationVar(&c.cooldown, "cooldown", 30*time.Second, "duration after which an ejected backend is readmitted")
+	flag.DurationVar(&c.dialTimeout, "dial-timeout", 5*time.Second, "timeout of acquiring a backend connection")
+	flag.DurationVar(&c.shutdownTimeout, "shutdown-timeout", 30*time.Second, "duration to wait for the forwarded connections on shutdown")
+	flag.Parse()
+
+	if err := run(c); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// run runs the proxy until a SIGINT or a SIGTERM signal is received
+func run(c config) error {
+	if c.backends == "" {
+		return errors.New("no backends")
+	}
+
+	strategy, ok := strategies[c.strategy]
+	if !ok {
+		return fmt.Errorf("unknown strategy %q", c.strategy)
+	}
+
+	opts := []pool.Option{
+		pool.WithMinIdle(c.minIdle),
+		pool.WithEjection(c.maxFailures, c.cooldown),
+	}
+	if c.healthCheck {
+		opts = append(opts, pool.WithHealthCheck(checkConn))
+
+		// forwarded connections are discarded so only the connections kept by the min idle are checked
+		if c.minIdle < 1 {
+			log.Print("health checks are enabled without idle connections, set -min-idle to check the backend connections")
+		}
+	}
+
+	p := newProxy(pool.NewMultiPool(strings.Split(c.backends, ","), c.limit, strategy, opts...), c.dialTimeout)
+
+	l, err := net.Listen("tcp", c.listen)
+	if err != nil {
+		return err
+	}
+	log.Printf("forwarding %s to %s", l.Addr(), c.backends)
+
+	var adminServer *http.Server
+	if c.admin != "" {
+		adminServer = &http.Server{Addr: c.admin, Handler: p.adminHandler()}
+		go func() {
+			if err := adminServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				log.Printf("admin endpoint: %s", err)
+			}
+		}()
+	}
+
+	// serve until a signal is received or the listener fails
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- p.serve(l)
+	}()
+
+	select {
+	case <-ctx.Done():
+		log.Print("shutting down")
+	case err := <-errs:
+		if err != nil {
+			log.Printf("listener: %s", err)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.shutdownTimeout)
+	defer cancel()
+
+	if adminServer != nil {
+		adminServer.Shutdown(ctx)
+	}
+
+	// the forwarded connections are closed forcibly if they don't end in the shutdown timeout
+	return p.shutdown(ctx)
+}
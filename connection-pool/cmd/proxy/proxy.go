@@ -0,0 +1,208 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	pool "github.com/ermanimer/design-patterns/connection-pool"
+)
+
+// healthCheckTimeout is the read deadline of the health checks of the idle backend connections
+const healthCheckTimeout = time.Millisecond
+
+// checkConn checks an idle backend connection by reading it with a short deadline, the connection is healthy if the read times out
+// checkConn consumes the data sent by the backend before the client, it shouldn't be used with server-first protocols
+func checkConn(conn net.Conn) error {
+	conn.SetReadDeadline(time.Now().Add(healthCheckTimeout))
+	defer conn.SetReadDeadline(time.Time{})
+
+	_, err := conn.Read(make([]byte, 1))
+	if errors.Is(err, os.ErrDeadlineExceeded) {
+		return nil
+	}
+	if err == nil {
+		return errors.New("unexpected data")
+	}
+
+	return err
+}
+
+// proxy forwards the accepted connections to the backends of a multi-endpoint pool
+type proxy struct {
+	pool        *pool.MultiPool
+	dialTimeout time.Duration
+	m           sync.Mutex
+	listener    net.Listener
+	conns       map[net.Conn]struct{}
+	wg          sync.WaitGroup
+}
+
+// newProxy creates and returns a new proxy
+func newProxy(p *pool.MultiPool, dialTimeout time.Duration) *proxy {
+	return &proxy{
+		pool:        p,
+		dialTimeout: dialTimeout,
+		conns:       make(map[net.Conn]struct{}),
+	}
+}
+
+// serve accepts the connections of the listener and forwards them until the listener is closed
+func (p *proxy) serve(l net.Listener) error {
+	p.m.Lock()
+	p.listener = l
+	p.m.Unlock()
+
+	for {
+		conn, err := l.Accept()
+		if errors.Is(err, net.ErrClosed) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		p.wg.Add(1)
+		go func() {
+			defer p.wg.Done()
+			p.forward(conn)
+		}()
+	}
+}
+
+// forward acquires a backend connection and copies the data between the connections until both sides are done
+// backend connections are discarded after forwarding since the state of the client's protocol can't be reused
+func (p *proxy) forward(client net.Conn) {
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), p.dialTimeout)
+	backend, err := p.pool.Acquire(ctx)
+	cancel()
+	if err != nil {
+		return
+	}
+	defer p.pool.Discard(backend)
+
+	p.track(client, backend)
+	defer p.untrack(client, backend)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		io.Copy(backend, client)
+		closeWrite(backend)
+	}()
+	io.Copy(client, backend)
+	closeWrite(client)
+	<-done
+}
+
+// closeWrite closes the writing side of the connection if it is supported, otherwise it closes the connection
+func closeWrite(conn net.Conn) {
+	if c, ok := conn.(interface{ CloseWrite() error }); ok {
+		c.CloseWrite()
+		return
+	}
+
+	conn.Close()
+}
+
+// track tracks the connections to close them forcibly on shutdown
+func (p *proxy) track(conns ...net.Conn) {
+	p.m.Lock()
+	defer p.m.Unlock()
+
+	for _, conn := range conns {
+		p.conns[conn] = struct{}{}
+	}
+}
+
+// untrack stops tracking the connections
+func (p *proxy) untrack(conns ...net.Conn) {
+	p.m.Lock()
+	defer p.m.Unlock()
+
+	for _, conn := range conns {
+		delete(p.conns, conn)
+	}
+}
+
+// active returns the number of the forwarded connections
+func (p *proxy) active() int {
+	p.m.Lock()
+	defer p.m.Unlock()
+
+	return len(p.conns) / 2
+}
+
+// shutdown stops accepting connections and waits for the forwarded connections to end, the connections are closed forcibly when the context is done
+func (p *proxy) shutdown(c context.Context) error {
+	p.m.Lock()
+	if p.listener != nil {
+		p.listener.Close()
+	}
+	p.m.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-c.Done():
+		p.m.Lock()
+		for conn := range p.conns {
+			conn.Close()
+		}
+		p.m.Unlock()
+		<-done
+	}
+
+	return p.pool.Close(c)
+}
+
+// backendStatus is the JSON representation of a backend
+type backendStatus struct {
+	Address string `json:"address"`
+	pool.Stats
+}
+
+// status is the JSON representation of the proxy
+type status struct {
+	Active   int             `json:"active"`
+	Backends []backendStatus `json:"backends"`
+}
+
+// adminHandler returns an http.Handler which responds the statistics of the backends as JSON on /stats and in the Prometheus text format on /metrics
+func (p *proxy) adminHandler() http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/stats", func(w http.ResponseWriter, r *http.Request) {
+		s := status{Active: p.active(), Backends: []backendStatus{}}
+		for address, stats := range p.pool.EndpointStats() {
+			s.Backends = append(s.Backends, backendStatus{Address: address, Stats: stats})
+		}
+		sort.Slice(s.Backends, func(i, j int) bool {
+			return s.Backends[i].Address < s.Backends[j].Address
+		})
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(s)
+	})
+
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		pool.WritePrometheus(w, p.pool.EndpointStats())
+	})
+
+	return mux
+}
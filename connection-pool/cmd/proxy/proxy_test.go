@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	pool "github.com/ermanimer/design-patterns/connection-pool"
+	"github.com/stretchr/testify/assert"
+)
+
+// echo starts a TCP server which writes back what it reads until the test ends
+func echo(t *testing.T) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				io.Copy(conn, conn)
+				conn.Close()
+			}()
+		}
+	}()
+
+	return l.Addr().String()
+}
+
+// start starts a proxy for the backends on a random port
+func start(t *testing.T, backends ...string) (*proxy, string) {
+	p := newProxy(pool.NewMultiPool(backends, 2, pool.RoundRobin, pool.WithHealthCheck(checkConn)), time.Second)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go p.serve(l)
+
+	return p, l.Addr().String()
+}
+
+func TestProxy(t *testing.T) {
+	backend1, backend2 := echo(t), echo(t)
+	p, address := start(t, backend1, backend2)
+
+	// connections should be forwarded to the backends in turn
+	var conns []net.Conn
+	for i := 0; i < 2; i++ {
+		conn, err := net.Dial("tcp", address)
+		assert.NoError(t, err)
+		_, err = conn.Write([]byte("hello"))
+		assert.NoError(t, err)
+		b := make([]byte, 5)
+		_, err = io.ReadFull(conn, b)
+		assert.NoError(t, err)
+		assert.Equal(t, "hello", string(b))
+		conns = append(conns, conn)
+	}
+
+	// the admin endpoint should respond the statistics of each backend
+	w := httptest.NewRecorder()
+	p.adminHandler().ServeHTTP(w, httptest.NewRequest("GET", "/stats", nil))
+	var s status
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &s))
+	assert.Equal(t, 2, s.Active)
+	assert.Len(t, s.Backends, 2)
+	for _, b := range s.Backends {
+		assert.Equal(t, 1, b.InUse)
+	}
+
+	w = httptest.NewRecorder()
+	p.adminHandler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	assert.True(t, strings.Contains(w.Body.String(), `pool_in_use{pool="`+backend1+`"} 1`))
+	assert.True(t, strings.Contains(w.Body.String(), `pool_in_use{pool="`+backend2+`"} 1`))
+	for _, line := range strings.Split(w.Body.String(), "\n") {
+		if strings.HasPrefix(line, "# TYPE ") {
+			assert.Equal(t, 1, strings.Count(w.Body.String(), line+"\n"), line)
+		}
+	}
+
+	// shutdown should wait for the forwarded connections
+	conns[0].Close()
+	done := make(chan error)
+	go func() {
+		done <- p.shutdown(context.Background())
+	}()
+	select {
+	case <-done:
+		t.Fatal("shutdown didn't wait for the forwarded connection")
+	case <-time.After(50 * time.Millisecond):
+	}
+	conns[1].Close()
+	assert.NoError(t, <-done)
+
+	// new connections should be refused after shutdown
+	_, err := net.Dial("tcp", address)
+	assert.Error(t, err)
+}
+
+func TestForcedShutdown(t *testing.T) {
+	p, address := start(t, echo(t))
+
+	conn, err := net.Dial("tcp", address)
+	assert.NoError(t, err)
+	defer conn.Close()
+	assert.Eventually(t, func() bool {
+		return p.active() == 1
+	}, time.Second, 10*time.Millisecond)
+
+	// forwarded connections should be closed when the shutdown times out
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	assert.NoError(t, p.shutdown(ctx))
+
+	_, err = conn.Read(make([]byte, 1))
+	assert.ErrorIs(t, err, io.EOF)
+}
@@ -0,0 +1,286 @@
+// Package faultnet injects network faults into connections, listeners and dialers to test the behaviors of pools on bad networks
+package faultnet
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// errors of the injected faults
+var (
+	ErrReset       = errors.New("connection reset by fault injection")
+	ErrDialFailure = errors.New("dial failed by fault injection")
+)
+
+// Faults are the faults injected into the connections
+// Latency is the delay before each read and write
+// Bandwidth is the maximum number of bytes per second of each read and write, zero is no maximum
+// ResetProbability is the probability of resetting the connection on each read and write
+// Hang makes the connections half-open, reads block until their deadlines and writes are dropped
+// DialFailureProbability is the probability of failing each dial
+type Faults struct {
+	Latency                time.Duration
+	Bandwidth              int
+	ResetProbability       float64
+	Hang                   bool
+	DialFailureProbability float64
+}
+
+// Injector injects its faults into the connections which it wraps, the faults can be changed at any time
+type Injector struct {
+	m      sync.Mutex
+	faults Faults
+	rand   *rand.Rand
+}
+
+// NewInjector creates and returns a new injector
+func NewInjector(faults Faults) *Injector {
+	return &Injector{
+		faults: faults,
+		rand:   rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// Set replaces the faults, Set applies to the wrapped connections too
+func (i *Injector) Set(faults Faults) {
+	i.m.Lock()
+	defer i.m.Unlock()
+
+	i.faults = faults
+}
+
+// Faults returns the faults
+func (i *Injector) Faults() Faults {
+	i.m.Lock()
+	defer i.m.Unlock()
+
+	return i.faults
+}
+
+// chance reports true with the probability
+func (i *Injector) chance(probability float64) bool {
+	i.m.Lock()
+	defer i.m.Unlock()
+
+	return probability > 0 && i.rand.Float64() < probability
+}
+
+// Dial dials the address and wraps the connection, Dial fails with ErrDialFailure by the dial failure probability
+func (i *Injector) Dial(ctx context.Context, network, address string) (net.Conn, error) {
+	if i.chance(i.Faults().DialFailureProbability) {
+		return nil, ErrDialFailure
+	}
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, network, address)
+	if err != nil {
+		return nil, err
+	}
+
+	return i.Conn(conn), nil
+}
+
+// Listener wraps the listener so its accepted connections are wrapped
+func (i *Injector) Listener(l net.Listener) net.Listener {
+	return &listener{Listener: l, injector: i}
+}
+
+// Conn wraps the connection
+func (i *Injector) Conn(conn net.Conn) net.Conn {
+	return &Conn{
+		Conn:     conn,
+		injector: i,
+		closed:   make(chan struct{}),
+	}
+}
+
+// listener is a listener whose accepted connections are wrapped by an injector
+type listener struct {
+	net.Listener
+	injector *Injector
+}
+
+// Accept accepts a connection and wraps it
+func (l *listener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+
+	return l.injector.Conn(conn), nil
+}
+
+// Conn is a connection which injects the faults of its injector into its reads and writes
+type Conn struct {
+	net.Conn
+	injector     *Injector
+	m            sync.Mutex
+	readDeadline time.Time
+	closed       chan struct{}
+	closeOnce    sync.Once
+}
+
+// compile time proof of interface implementation
+var _ net.Conn = (*Conn)(nil)
+
+// Read reads from the connection after injecting the faults
+func (c *Conn) Read(b []byte) (int, error) {
+	faults, err := c.inject()
+	if err != nil {
+		return 0, err
+	}
+
+	// block until the deadline like a peer which stopped responding
+	if faults.Hang {
+		c.m.Lock()
+		deadline := c.readDeadline
+		c.m.Unlock()
+		return 0, c.hang(deadline)
+	}
+
+	if faults.Bandwidth > 0 && len(b) > faults.Bandwidth {
+		b = b[:faults.Bandwidth]
+	}
+
+	n, err := c.Conn.Read(b)
+	c.throttle(faults, n)
+
+	return n, err
+}
+
+// Write writes to the connection after injecting the faults
+func (c *Conn) Write(b []byte) (int, error) {
+	faults, err := c.inject()
+	if err != nil {
+		return 0, err
+	}
+
+	// drop the data like a peer which stopped responding
+	if faults.Hang {
+		return len(b), nil
+	}
+
+	if faults.Bandwidth == 0 {
+		return c.Conn.Write(b)
+	}
+
+	// write in chunks of a second's bandwidth
+	written := 0
+	for written < len(b) {
+		chunk := b[written:]
+		if len(chunk) > faults.Bandwidth {
+			chunk = chunk[:faults.Bandwidth]
+		}
+		n, err := c.Conn.Write(chunk)
+		written += n
+		if err != nil {
+			return written, err
+		}
+		c.throttle(faults, n)
+	}
+
+	return written, nil
+}
+
+// SetDeadline sets the read and the write deadlines
+func (c *Conn) SetDeadline(t time.Time) error {
+	c.m.Lock()
+	c.readDeadline = t
+	c.m.Unlock()
+
+	return c.Conn.SetDeadline(t)
+}
+
+// SetReadDeadline sets the read deadline
+func (c *Conn) SetReadDeadline(t time.Time) error {
+	c.m.Lock()
+	c.readDeadline = t
+	c.m.Unlock()
+
+	return c.Conn.SetReadDeadline(t)
+}
+
+// Close closes the connection and stops the injected delays
+func (c *Conn) Close() error {
+	c.closeOnce.Do(func() {
+		close(c.closed)
+	})
+
+	return c.Conn.Close()
+}
+
+// inject delays the operation by the latency and resets the connection by the reset probability
+func (c *Conn) inject() (Faults, error) {
+	faults := c.injector.Faults()
+
+	if err := c.sleep(faults.Latency); err != nil {
+		return faults, err
+	}
+
+	if c.injector.chance(faults.ResetProbability) {
+		c.reset()
+		return faults, ErrReset
+	}
+
+	return faults, nil
+}
+
+// reset closes the connection, the remote side of a TCP connection receives a reset instead of a graceful close
+func (c *Conn) reset() {
+	if tc, ok := c.Conn.(*net.TCPConn); ok {
+		tc.SetLinger(0)
+	}
+
+	c.Close()
+}
+
+// throttle delays the operation which transferred n bytes by the bandwidth
+func (c *Conn) throttle(faults Faults, n int) {
+	if faults.Bandwidth > 0 && n > 0 {
+		c.sleep(time.Duration(n) * time.Second / time.Duration(faults.Bandwidth))
+	}
+}
+
+// sleep sleeps for the duration, sleep returns net.ErrClosed if the connection is closed
+func (c *Conn) sleep(d time.Duration) error {
+	if d <= 0 {
+		select {
+		case <-c.closed:
+			return net.ErrClosed
+		default:
+			return nil
+		}
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-c.closed:
+		return net.ErrClosed
+	}
+}
+
+// hang blocks until the deadline, hang returns net.ErrClosed if the connection is closed
+func (c *Conn) hang(deadline time.Time) error {
+	var timeout <-chan time.Time
+	if !deadline.IsZero() {
+		timer := time.NewTimer(time.Until(deadline))
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	select {
+	case <-timeout:
+		return os.ErrDeadlineExceeded
+	case <-c.closed:
+		return net.ErrClosed
+	}
+}
@@ -0,0 +1,128 @@
+package faultnet
+
+import (
+	"context"
+	"io"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// echo starts a TCP server which writes back what it reads until the test ends
+func echo(t *testing.T) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				io.Copy(conn, conn)
+				conn.Close()
+			}()
+		}
+	}()
+
+	return l.Addr().String()
+}
+
+// roundTrip writes the data and reads it back
+func roundTrip(conn net.Conn, data []byte) error {
+	if _, err := conn.Write(data); err != nil {
+		return err
+	}
+
+	_, err := io.ReadFull(conn, make([]byte, len(data)))
+
+	return err
+}
+
+func TestInjector(t *testing.T) {
+	address := echo(t)
+
+	// latency should delay reads and writes
+	t.Run("latency", func(t *testing.T) {
+		i := NewInjector(Faults{Latency: 20 * time.Millisecond})
+		conn, err := i.Dial(context.Background(), "tcp", address)
+		assert.NoError(t, err)
+		defer conn.Close()
+
+		start := time.Now()
+		assert.NoError(t, roundTrip(conn, []byte("hello")))
+		assert.GreaterOrEqual(t, time.Since(start), 40*time.Millisecond)
+	})
+
+	// bandwidth should limit the transfer rate
+	t.Run("bandwidth", func(t *testing.T) {
+		i := NewInjector(Faults{Bandwidth: 10 * 1024})
+		conn, err := i.Dial(context.Background(), "tcp", address)
+		assert.NoError(t, err)
+		defer conn.Close()
+
+		start := time.Now()
+		assert.NoError(t, roundTrip(conn, make([]byte, 2*1024)))
+		assert.GreaterOrEqual(t, time.Since(start), 400*time.Millisecond)
+	})
+
+	// resets should fail the operations and close the connection
+	t.Run("reset", func(t *testing.T) {
+		i := NewInjector(Faults{ResetProbability: 1})
+		conn, err := i.Dial(context.Background(), "tcp", address)
+		assert.NoError(t, err)
+
+		_, err = conn.Write([]byte("hello"))
+		assert.ErrorIs(t, err, ErrReset)
+		i.Set(Faults{})
+		_, err = conn.Write([]byte("hello"))
+		assert.ErrorIs(t, err, net.ErrClosed)
+	})
+
+	// half-open connections should drop writes and block reads until the deadline
+	t.Run("hang", func(t *testing.T) {
+		i := NewInjector(Faults{Hang: true})
+		conn, err := i.Dial(context.Background(), "tcp", address)
+		assert.NoError(t, err)
+		defer conn.Close()
+
+		conn.SetReadDeadline(time.Now().Add(20 * time.Millisecond))
+		assert.ErrorIs(t, roundTrip(conn, []byte("hello")), os.ErrDeadlineExceeded)
+	})
+
+	// dials should fail by the dial failure probability
+	t.Run("dial failure", func(t *testing.T) {
+		i := NewInjector(Faults{DialFailureProbability: 1})
+		_, err := i.Dial(context.Background(), "tcp", address)
+		assert.ErrorIs(t, err, ErrDialFailure)
+	})
+
+	// accepted connections should be wrapped
+	t.Run("listener", func(t *testing.T) {
+		i := NewInjector(Faults{ResetProbability: 1})
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		assert.NoError(t, err)
+		l = i.Listener(l)
+		defer l.Close()
+
+		go func() {
+			conn, err := net.Dial("tcp", l.Addr().String())
+			if err == nil {
+				defer conn.Close()
+				conn.Write([]byte("hello"))
+			}
+		}()
+
+		conn, err := l.Accept()
+		assert.NoError(t, err)
+		_, err = conn.Read(make([]byte, 5))
+		assert.ErrorIs(t, err, ErrReset)
+	})
+}
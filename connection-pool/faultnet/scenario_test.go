@@ -0,0 +1,146 @@
+package faultnet
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	pool "github.com/ermanimer/design-patterns/connection-pool"
+	"github.com/stretchr/testify/assert"
+)
+
+// newPool creates a pool which dials through the injector and checks idle connections with a round trip
+func newPool(i *Injector, address string) pool.Pool[net.Conn] {
+	return pool.New(func(c context.Context) (net.Conn, error) {
+		return i.Dial(c, "tcp", address)
+	}, 2, pool.WithHealthCheck(func(conn net.Conn) error {
+		conn.SetDeadline(time.Now().Add(50 * time.Millisecond))
+		defer conn.SetDeadline(time.Time{})
+
+		return roundTrip(conn, []byte("ping"))
+	}))
+}
+
+func TestScenarios(t *testing.T) {
+	address := echo(t)
+
+	// the pool should count the dial failures and create connections once the dials succeed
+	t.Run("dial failures", func(t *testing.T) {
+		i := NewInjector(Faults{DialFailureProbability: 1})
+		p := newPool(i, address)
+		defer p.Close(context.Background())
+
+		_, err := p.Acquire(context.Background())
+		assert.ErrorIs(t, err, ErrDialFailure)
+		assert.Equal(t, int64(1), p.Stats().DialErrors)
+
+		i.Set(Faults{})
+		conn, err := p.Acquire(context.Background())
+		assert.NoError(t, err)
+		assert.NoError(t, roundTrip(conn, []byte("hello")))
+		p.Release(conn)
+	})
+
+	// the pool should replace the reset connections which are discarded by their users
+	t.Run("resets", func(t *testing.T) {
+		i := NewInjector(Faults{})
+		p := newPool(i, address)
+		defer p.Close(context.Background())
+
+		conn, err := p.Acquire(context.Background())
+		assert.NoError(t, err)
+
+		i.Set(Faults{ResetProbability: 1})
+		assert.ErrorIs(t, roundTrip(conn, []byte("hello")), ErrReset)
+		p.Discard(conn)
+
+		i.Set(Faults{})
+		conn, err = p.Acquire(context.Background())
+		assert.NoError(t, err)
+		assert.NoError(t, roundTrip(conn, []byte("hello")))
+		p.Release(conn)
+		assert.Equal(t, 1, p.Stats().Open)
+	})
+
+	// the health check should discard the idle connections which reset
+	t.Run("idle resets", func(t *testing.T) {
+		i := NewInjector(Faults{})
+		p := newPool(i, address)
+		defer p.Close(context.Background())
+
+		conn, err := p.Acquire(context.Background())
+		assert.NoError(t, err)
+		p.Release(conn)
+
+		i.Set(Faults{ResetProbability: 1})
+		replacement, err := p.Acquire(context.Background())
+		assert.NoError(t, err)
+		assert.NotEqual(t, conn, replacement)
+		assert.Equal(t, int64(1), p.Stats().UnhealthyClosed)
+
+		i.Set(Faults{})
+		assert.NoError(t, roundTrip(replacement, []byte("hello")))
+		p.Release(replacement)
+	})
+
+	// the health check should discard the half-open idle connections
+	t.Run("half-open hangs", func(t *testing.T) {
+		i := NewInjector(Faults{})
+		p := newPool(i, address)
+		defer p.Close(context.Background())
+
+		conn, err := p.Acquire(context.Background())
+		assert.NoError(t, err)
+		p.Release(conn)
+
+		i.Set(Faults{Hang: true})
+		replacement, err := p.Acquire(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1), p.Stats().UnhealthyClosed)
+
+		i.Set(Faults{})
+		assert.NoError(t, roundTrip(replacement, []byte("hello")))
+		p.Release(replacement)
+	})
+
+	// the health check should discard the idle connections which are slower than its deadline
+	t.Run("latency", func(t *testing.T) {
+		i := NewInjector(Faults{})
+		p := newPool(i, address)
+		defer p.Close(context.Background())
+
+		conn, err := p.Acquire(context.Background())
+		assert.NoError(t, err)
+		p.Release(conn)
+
+		i.Set(Faults{Latency: 100 * time.Millisecond})
+		replacement, err := p.Acquire(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1), p.Stats().UnhealthyClosed)
+
+		i.Set(Faults{})
+		assert.NoError(t, roundTrip(replacement, []byte("hello")))
+		p.Release(replacement)
+	})
+
+	// the health check should discard the idle connections which are throttled below its deadline
+	t.Run("bandwidth", func(t *testing.T) {
+		i := NewInjector(Faults{})
+		p := newPool(i, address)
+		defer p.Close(context.Background())
+
+		conn, err := p.Acquire(context.Background())
+		assert.NoError(t, err)
+		p.Release(conn)
+
+		i.Set(Faults{Bandwidth: 1})
+		replacement, err := p.Acquire(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1), p.Stats().UnhealthyClosed)
+
+		i.Set(Faults{})
+		assert.NoError(t, roundTrip(replacement, []byte("hello")))
+		p.Release(replacement)
+	})
+}
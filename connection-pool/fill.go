@@ -0,0 +1,100 @@
+package pool
+
+import (
+	"context"
+	"time"
+)
+
+// backoffs of the filler between failed creations
+const (
+	minFillBackoff = 100 * time.Millisecond
+	maxFillBackoff = 10 * time.Second
+)
+
+// fill keeps the min idle resources in the pool until the pool is closed, fill runs after the creation and whenever the filler is woken up
+func (p *pool[T]) fill() {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go func() {
+		<-p.closed
+		cancel()
+	}()
+
+	backoff := minFillBackoff
+	for {
+		for p.needsIdle() {
+			if p.createIdle(ctx) {
+				backoff = minFillBackoff
+				continue
+			}
+
+			// wait before retrying the failed creation
+			select {
+			case <-time.After(backoff):
+			case <-p.closed:
+				return
+			}
+			backoff *= 2
+			if backoff > maxFillBackoff {
+				backoff = maxFillBackoff
+			}
+		}
+
+		select {
+		case <-p.refill:
+		case <-p.closed:
+			return
+		}
+	}
+}
+
+// needsIdle reports whether the open pool has fewer idle resources than the min idle and has enough space for a new resource
+func (p *pool[T]) needsIdle() bool {
+	p.m.Lock()
+	defer p.m.Unlock()
+
+	return !p.isClosed() && len(p.idle) < p.options.minIdle && p.open < p.limit
+}
+
+// createIdle creates a new idle resource, createIdle reports false if the creation fails
+// createIdle reports true without creating a resource if the pool is full
+func (p *pool[T]) createIdle(ctx context.Context) bool {
+	p.m.Lock()
+	if p.open >= p.limit {
+		p.m.Unlock()
+		return true
+	}
+	p.open++
+	p.m.Unlock()
+
+	resource, err := p.factory(ctx)
+	if err != nil {
+		p.m.Lock()
+		p.stats.DialErrors++
+		p.free()
+		p.m.Unlock()
+		return false
+	}
+
+	p.m.Lock()
+	p.resources[resource] = &resourceState{createdAt: time.Now()}
+	p.m.Unlock()
+
+	// the new resource is handed to the first waiter or kept idle, put discards it if the pool is closed while creating it
+	p.put(resource)
+
+	return true
+}
+
+// wakeFiller wakes the filler up without blocking after the idle resources decrease
+func (p *pool[T]) wakeFiller() {
+	if p.options.minIdle == 0 {
+		return
+	}
+
+	select {
+	case p.refill <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,389 @@
+package pool
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+// KeyedFactory creates a new resource for the key, it should stop creating the resource when the context is done
+type KeyedFactory[K comparable, T Resource] func(context.Context, K) (T, error)
+
+// subPool is the pool of a key
+type subPool[T Resource] struct {
+	pool     *pool[T]
+	lastUsed time.Time
+}
+
+// KeyedPool is a pool of resources grouped by keys like the shards of a database.
+// KeyedPool keeps a sub-pool of up to limit resources per key and up to globalLimit resources in total,
+// the idle resources of the other keys are closed to create new resources when the pool reaches the global limit.
+// Sub-pools of the keys which aren't used for the max key idle time are closed and removed.
+type KeyedPool[K comparable, T Resource] struct {
+	factory   KeyedFactory[K, T]
+	limit     int
+	opts      []Option
+	options   options
+	semaphore chan struct{}
+	m         sync.Mutex
+	pools     map[K]*subPool[T]
+	owners    map[T]*subPool[T]
+	affinity  map[string]T
+	sessions  map[T]string
+	idle      chan struct{}
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+// NewKeyedPool creates and returns a new keyed pool, zero globalLimit is no global limit
+// opts are applied to the sub-pool of each key, NewKeyedPool starts an evictor if the max key idle time is set
+func NewKeyedPool[K comparable, T Resource](factory KeyedFactory[K, T], limit, globalLimit int, opts ...Option) *KeyedPool[K, T] {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	kp := &KeyedPool[K, T]{
+		factory:  factory,
+		limit:    limit,
+		opts:     opts,
+		options:  o,
+		pools:    make(map[K]*subPool[T]),
+		owners:   make(map[T]*subPool[T]),
+		affinity: make(map[string]T),
+		sessions: make(map[T]string),
+		idle:     make(chan struct{}),
+		closed:   make(chan struct{}),
+	}
+
+	if globalLimit > 0 {
+		kp.semaphore = make(chan struct{}, globalLimit)
+	}
+
+	if o.maxKeyIdleTime > 0 {
+		go kp.evictKeys(tickInterval(o.maxKeyIdleTime))
+	}
+
+	return kp
+}
+
+// Acquire acquires a resource from the sub-pool of the key, Acquire creates the sub-pool if it doesn't exist
+func (kp *KeyedPool[K, T]) Acquire(c context.Context, key K) (T, error) {
+	return kp.AcquireSticky(c, key, "")
+}
+
+// AcquireSticky acquires the resource last acquired by the session if it is idle, otherwise it acquires a resource like Acquire.
+// Empty session acquires without the affinity.
+func (kp *KeyedPool[K, T]) AcquireSticky(c context.Context, key K, session string) (T, error) {
+	var zero T
+
+	for {
+		sp, err := kp.subPool(key)
+		if err != nil {
+			return zero, err
+		}
+
+		// acquire the resource of the session if it is idle
+		kp.m.Lock()
+		resource, ok := kp.affinity[session]
+		kp.m.Unlock()
+		if session != "" && ok && sp.pool.acquireIdle(resource) {
+			return resource, nil
+		}
+
+		resource, err = sp.pool.Acquire(c)
+		// try again with a new sub-pool if the sub-pool is evicted in the meantime
+		if errors.Is(err, ErrPoolClosed) {
+			continue
+		}
+		if err != nil {
+			return zero, err
+		}
+
+		kp.m.Lock()
+		kp.owners[resource] = sp
+		if session != "" {
+			kp.stick(session, resource)
+		}
+		kp.m.Unlock()
+
+		return resource, nil
+	}
+}
+
+// Release releases the resource back to the sub-pool of its key
+func (kp *KeyedPool[K, T]) Release(resource T) {
+	if sp := kp.owner(resource); sp != nil {
+		sp.pool.Release(resource)
+	}
+}
+
+// Discard discards the resource from the sub-pool of its key
+func (kp *KeyedPool[K, T]) Discard(resource T) {
+	if sp := kp.owner(resource); sp != nil {
+		sp.pool.Discard(resource)
+	}
+}
+
+// Close closes the sub-pools and returns the first error
+func (kp *KeyedPool[K, T]) Close(c context.Context) error {
+	closed := false
+	kp.closeOnce.Do(func() {
+		close(kp.closed)
+		closed = true
+	})
+	if !closed {
+		return ErrPoolClosed
+	}
+
+	pools := kp.subPools()
+
+	var first error
+	for _, sp := range pools {
+		if err := sp.pool.Close(c); err != nil && first == nil {
+			first = err
+		}
+	}
+
+	return first
+}
+
+// Stats returns the sums of the statistics of the sub-pools, MaxOpen is the global limit if it is set
+func (kp *KeyedPool[K, T]) Stats() Stats {
+	var sum Stats
+	for _, s := range kp.KeyStats() {
+		sum.add(s)
+	}
+
+	if kp.semaphore != nil {
+		sum.MaxOpen = cap(kp.semaphore)
+	}
+
+	return sum
+}
+
+// KeyStats returns the statistics of the sub-pools by their keys
+func (kp *KeyedPool[K, T]) KeyStats() map[K]Stats {
+	kp.m.Lock()
+	pools := make(map[K]*subPool[T], len(kp.pools))
+	for key, sp := range kp.pools {
+		pools[key] = sp
+	}
+	kp.m.Unlock()
+
+	stats := make(map[K]Stats, len(pools))
+	for key, sp := range pools {
+		stats[key] = sp.pool.Stats()
+	}
+
+	return stats
+}
+
+// Acquisitions returns the outstanding acquisitions of the sub-pools from the oldest to the newest
+func (kp *KeyedPool[K, T]) Acquisitions() []Acquisition {
+	pools := kp.subPools()
+
+	var acquisitions []Acquisition
+	for _, sp := range pools {
+		acquisitions = append(acquisitions, sp.pool.Acquisitions()...)
+	}
+	sort.Slice(acquisitions, func(i, j int) bool {
+		return acquisitions[i].AcquiredAt.Before(acquisitions[j].AcquiredAt)
+	})
+
+	return acquisitions
+}
+
+// subPools returns the sub-pools of the keys
+func (kp *KeyedPool[K, T]) subPools() []*subPool[T] {
+	kp.m.Lock()
+	defer kp.m.Unlock()
+
+	pools := make([]*subPool[T], 0, len(kp.pools))
+	for _, sp := range kp.pools {
+		pools = append(pools, sp)
+	}
+
+	return pools
+}
+
+// subPool returns the sub-pool of the key and marks it used, subPool creates the sub-pool if it doesn't exist
+func (kp *KeyedPool[K, T]) subPool(key K) (*subPool[T], error) {
+	kp.m.Lock()
+	defer kp.m.Unlock()
+
+	select {
+	case <-kp.closed:
+		return nil, ErrPoolClosed
+	default:
+	}
+
+	sp, ok := kp.pools[key]
+	if !ok {
+		opts := append(kp.opts[:len(kp.opts):len(kp.opts)], func(o *options) {
+			o.onClose = kp.closedResource
+			o.onIdle = kp.idleResource
+		})
+		factory := func(c context.Context) (T, error) {
+			return kp.create(c, key)
+		}
+		sp = &subPool[T]{pool: New(factory, kp.limit, opts...).(*pool[T])}
+		kp.pools[key] = sp
+	}
+	sp.lastUsed = time.Now()
+
+	return sp, nil
+}
+
+// create creates a new resource for the key after reserving a space in the global limit
+func (kp *KeyedPool[K, T]) create(c context.Context, key K) (T, error) {
+	var zero T
+
+	if err := kp.reserve(c); err != nil {
+		return zero, err
+	}
+
+	resource, err := kp.factory(c, key)
+	if err != nil {
+		kp.unreserve()
+		return zero, err
+	}
+
+	return resource, nil
+}
+
+// reserve reserves a space in the global limit, reserve closes the idle resources of the sub-pools to free spaces
+// reserve waits for a free space or a new idle resource to close if there isn't any
+func (kp *KeyedPool[K, T]) reserve(c context.Context) error {
+	if kp.semaphore == nil {
+		return nil
+	}
+
+	for {
+		select {
+		case kp.semaphore <- struct{}{}:
+			return nil
+		default:
+		}
+
+		// take the notification channel before the eviction so the resources released in the meantime aren't missed
+		kp.m.Lock()
+		idle := kp.idle
+		kp.m.Unlock()
+
+		if kp.evictIdle() {
+			continue
+		}
+
+		select {
+		case kp.semaphore <- struct{}{}:
+			return nil
+		case <-idle:
+		case <-c.Done():
+			return c.Err()
+		}
+	}
+}
+
+// idleResource notifies the reservations waiting in the global limit that a resource is idle
+func (kp *KeyedPool[K, T]) idleResource() {
+	kp.m.Lock()
+	defer kp.m.Unlock()
+
+	close(kp.idle)
+	kp.idle = make(chan struct{})
+}
+
+// unreserve frees a space in the global limit
+func (kp *KeyedPool[K, T]) unreserve() {
+	if kp.semaphore != nil {
+		<-kp.semaphore
+	}
+}
+
+// evictIdle closes an idle resource of the least recently used sub-pool, evictIdle reports false if there isn't any idle resource
+func (kp *KeyedPool[K, T]) evictIdle() bool {
+	pools := kp.subPools()
+	kp.m.Lock()
+	sort.Slice(pools, func(i, j int) bool {
+		return pools[i].lastUsed.Before(pools[j].lastUsed)
+	})
+	kp.m.Unlock()
+
+	for _, sp := range pools {
+		if sp.pool.evictIdle() {
+			return true
+		}
+	}
+
+	return false
+}
+
+// closedResource frees the space of the closed resource in the global limit and forgets its owner and its session
+func (kp *KeyedPool[K, T]) closedResource(resource any) {
+	kp.unreserve()
+
+	kp.m.Lock()
+	defer kp.m.Unlock()
+
+	r := resource.(T)
+	delete(kp.owners, r)
+	if session, ok := kp.sessions[r]; ok {
+		delete(kp.affinity, session)
+		delete(kp.sessions, r)
+	}
+}
+
+// stick sets the resource as the resource of the session, it must be called with the mutex held
+func (kp *KeyedPool[K, T]) stick(session string, resource T) {
+	if previous, ok := kp.affinity[session]; ok {
+		delete(kp.sessions, previous)
+	}
+	if previous, ok := kp.sessions[resource]; ok {
+		delete(kp.affinity, previous)
+	}
+
+	kp.affinity[session] = resource
+	kp.sessions[resource] = session
+}
+
+// owner returns the sub-pool of the resource, resources keep their sub-pools after their keys are evicted
+func (kp *KeyedPool[K, T]) owner(resource T) *subPool[T] {
+	kp.m.Lock()
+	defer kp.m.Unlock()
+
+	return kp.owners[resource]
+}
+
+// evictKeys closes and removes the sub-pools which aren't used for the max key idle time on every interval until the pool is closed
+func (kp *KeyedPool[K, T]) evictKeys(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-kp.closed:
+			return
+		}
+
+		// remove the sub-pools without resources in use
+		now := time.Now()
+		var evicted []*subPool[T]
+
+		kp.m.Lock()
+		for key, sp := range kp.pools {
+			if now.Sub(sp.lastUsed) >= kp.options.maxKeyIdleTime && sp.pool.Stats().InUse == 0 {
+				evicted = append(evicted, sp)
+				delete(kp.pools, key)
+			}
+		}
+		kp.m.Unlock()
+
+		for _, sp := range evicted {
+			sp.pool.Close(context.Background())
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package pool
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// shard is a fake resource of a shard
+type shard struct {
+	session
+	key string
+}
+
+func TestKeyedPool(t *testing.T) {
+	kp := NewKeyedPool(func(c context.Context, key string) (*shard, error) {
+		return &shard{key: key}, nil
+	}, 2, 3)
+	defer kp.Close(context.Background())
+
+	// resources should be created for their keys within the per-key limit
+	a1, err := kp.Acquire(context.Background(), "a")
+	assert.NoError(t, err)
+	assert.Equal(t, "a", a1.key)
+	a2, err := kp.Acquire(context.Background(), "a")
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err = kp.Acquire(ctx, "a")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	// idle resources of the other keys should be closed at the global limit
+	b1, err := kp.Acquire(context.Background(), "b")
+	assert.NoError(t, err)
+	kp.Release(a1)
+	kp.Release(b1)
+	c1, err := kp.Acquire(context.Background(), "c")
+	assert.NoError(t, err)
+	assert.True(t, a1.closed)
+	assert.False(t, b1.closed)
+	assert.Equal(t, 3, kp.Stats().Open)
+	assert.Equal(t, 3, kp.Stats().MaxOpen)
+	assert.Equal(t, 1, kp.KeyStats()["a"].Open)
+
+	kp.Release(a2)
+	kp.Release(c1)
+}
+
+func TestGlobalLimitWaiter(t *testing.T) {
+	kp := NewKeyedPool(func(c context.Context, key string) (*shard, error) {
+		return &shard{key: key}, nil
+	}, 1, 1)
+	defer kp.Close(context.Background())
+
+	a, err := kp.Acquire(context.Background(), "a")
+	assert.NoError(t, err)
+
+	// releasing a resource of another key should unblock the acquisition waiting at the global limit
+	acquired := make(chan *shard)
+	go func() {
+		b, err := kp.Acquire(context.Background(), "b")
+		assert.NoError(t, err)
+		acquired <- b
+	}()
+	time.Sleep(20 * time.Millisecond)
+	kp.Release(a)
+
+	select {
+	case b := <-acquired:
+		assert.Equal(t, "b", b.key)
+		assert.True(t, a.closed)
+		kp.Release(b)
+	case <-time.After(time.Second):
+		t.Fatal("acquisition isn't unblocked")
+	}
+}
+
+func TestStickyAcquisition(t *testing.T) {
+	kp := NewKeyedPool(func(c context.Context, key string) (*shard, error) {
+		return &shard{key: key}, nil
+	}, 2, 0)
+	defer kp.Close(context.Background())
+
+	s1, err := kp.AcquireSticky(context.Background(), "a", "alice")
+	assert.NoError(t, err)
+	s2, err := kp.AcquireSticky(context.Background(), "a", "bob")
+	assert.NoError(t, err)
+	kp.Release(s1)
+	kp.Release(s2)
+
+	// sessions should get their own resources back when they are idle
+	s, err := kp.AcquireSticky(context.Background(), "a", "alice")
+	assert.NoError(t, err)
+	assert.Same(t, s1, s)
+
+	// sessions should get another resource when their resources are in use
+	s, err = kp.AcquireSticky(context.Background(), "a", "carol")
+	assert.NoError(t, err)
+	assert.Same(t, s2, s)
+	kp.Release(s1)
+	kp.Release(s2)
+}
+
+func TestKeyEviction(t *testing.T) {
+	kp := NewKeyedPool(func(c context.Context, key string) (*shard, error) {
+		return &shard{key: key}, nil
+	}, 1, 0, WithMaxKeyIdleTime(20*time.Millisecond))
+	defer kp.Close(context.Background())
+
+	s, err := kp.Acquire(context.Background(), "a")
+	assert.NoError(t, err)
+
+	// keys with resources in use shouldn't be evicted
+	time.Sleep(40 * time.Millisecond)
+	assert.Contains(t, kp.KeyStats(), "a")
+
+	// unused keys should be evicted with their idle resources
+	kp.Release(s)
+	assert.Eventually(t, func() bool {
+		return len(kp.KeyStats()) == 0
+	}, time.Second, 10*time.Millisecond)
+
+	// evicted keys should get new sub-pools
+	replacement, err := kp.Acquire(context.Background(), "a")
+	assert.NoError(t, err)
+	assert.NotSame(t, s, replacement)
+	kp.Release(replacement)
+}
+
+func TestShortKeyIdleTime(t *testing.T) {
+	kp := NewKeyedPool(func(c context.Context, key string) (*shard, error) {
+		return &shard{key: key}, nil
+	}, 1, 0, WithMaxKeyIdleTime(time.Nanosecond))
+	defer kp.Close(context.Background())
+
+	// durations shorter than the minimum interval shouldn't stop the eviction
+	s, err := kp.Acquire(context.Background(), "a")
+	assert.NoError(t, err)
+	kp.Release(s)
+	assert.Eventually(t, func() bool {
+		return len(kp.KeyStats()) == 0
+	}, time.Second, 10*time.Millisecond)
+}
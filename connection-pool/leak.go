@@ -0,0 +1,92 @@
+package pool
+
+import (
+	"runtime/debug"
+	"sort"
+	"time"
+)
+
+// Acquisition is an outstanding acquisition of a resource
+// Stack is the stack trace of the Acquire call, it is recorded only if the leak detection is enabled
+type Acquisition struct {
+	AcquiredAt time.Time
+	Stack      string
+}
+
+// Acquisitions returns the outstanding acquisitions of the pool from the oldest to the newest
+func (p *pool[T]) Acquisitions() []Acquisition {
+	p.m.Lock()
+	defer p.m.Unlock()
+
+	var acquisitions []Acquisition
+	for _, s := range p.resources {
+		if !s.acquiredAt.IsZero() {
+			acquisitions = append(acquisitions, Acquisition{AcquiredAt: s.acquiredAt, Stack: s.stack})
+		}
+	}
+	sort.Slice(acquisitions, func(i, j int) bool {
+		return acquisitions[i].AcquiredAt.Before(acquisitions[j].AcquiredAt)
+	})
+
+	return acquisitions
+}
+
+// acquired records the acquisition of the resource and the stack of the caller if the leak detection is enabled
+func (p *pool[T]) acquired(resource T) {
+	var stack string
+	if p.options.leakThreshold > 0 {
+		stack = string(debug.Stack())
+	}
+
+	p.m.Lock()
+	defer p.m.Unlock()
+
+	if s, ok := p.resources[resource]; ok {
+		s.acquiredAt = time.Now()
+		s.stack = stack
+		s.leaked = false
+	}
+}
+
+// detectLeaks reports the resources held longer than the leak threshold on every interval until the pool is closed
+// detectLeaks closes the leaked resources and frees their spaces if the leak reclaim is enabled
+func (p *pool[T]) detectLeaks(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-p.closed:
+			return
+		}
+
+		// report each leak once
+		now := time.Now()
+		var leaks []Acquisition
+		var leaked []T
+
+		p.m.Lock()
+		for resource, s := range p.resources {
+			if s.acquiredAt.IsZero() || s.leaked || now.Sub(s.acquiredAt) < p.options.leakThreshold {
+				continue
+			}
+			s.leaked = true
+			leaks = append(leaks, Acquisition{AcquiredAt: s.acquiredAt, Stack: s.stack})
+			leaked = append(leaked, resource)
+		}
+		p.m.Unlock()
+
+		for _, leak := range leaks {
+			if p.options.onLeak != nil {
+				p.options.onLeak(leak)
+			}
+		}
+
+		if p.options.reclaimLeaks {
+			for _, resource := range leaked {
+				p.discard(resource, closedByLeak)
+			}
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package pool
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLeakDetection(t *testing.T) {
+	var m sync.Mutex
+	var leaks []Acquisition
+	p := newSessionPool(t, 1, WithLeakDetection(20*time.Millisecond, func(a Acquisition) {
+		m.Lock()
+		defer m.Unlock()
+
+		leaks = append(leaks, a)
+	}), WithLeakReclaim())
+
+	// outstanding acquisitions should be listed with the stacks of the callers
+	s, err := p.Acquire(context.Background())
+	assert.NoError(t, err)
+	acquisitions := p.Acquisitions()
+	assert.Len(t, acquisitions, 1)
+	assert.Contains(t, acquisitions[0].Stack, "TestLeakDetection")
+
+	// the leaked resource should be reported once and reclaimed
+	assert.Eventually(t, func() bool {
+		return p.Stats().LeakedClosed == 1
+	}, time.Second, 10*time.Millisecond)
+	m.Lock()
+	assert.Len(t, leaks, 1)
+	m.Unlock()
+	assert.True(t, s.closed)
+	assert.Empty(t, p.Acquisitions())
+
+	// releasing the reclaimed resource shouldn't return it to the pool
+	p.Release(s)
+	assert.Equal(t, 0, p.Stats().Open)
+
+	// released resources shouldn't be reported
+	s, err = p.Acquire(context.Background())
+	assert.NoError(t, err)
+	p.Release(s)
+	assert.Empty(t, p.Acquisitions())
+	time.Sleep(40 * time.Millisecond)
+	assert.Equal(t, int64(1), p.Stats().LeakedClosed)
+}
+
+func TestShortLeakThreshold(t *testing.T) {
+	leaks := make(chan Acquisition, 1)
+	p := newSessionPool(t, 1, WithLeakDetection(time.Nanosecond, func(a Acquisition) {
+		leaks <- a
+	}))
+
+	// thresholds shorter than the minimum interval shouldn't stop the leak detector
+	s, err := p.Acquire(context.Background())
+	assert.NoError(t, err)
+	select {
+	case <-leaks:
+	case <-time.After(time.Second):
+		t.Fatal("leak isn't reported")
+	}
+	p.Release(s)
+}
@@ -0,0 +1,384 @@
+package pool
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Strategy is the endpoint selection strategy of a multi-endpoint pool
+type Strategy int
+
+// endpoint selection strategies
+const (
+	RoundRobin Strategy = iota
+	LeastInUse
+	PowerOfTwoChoices
+)
+
+// ErrNoEndpoints is returned by Acquire when all endpoints are ejected or tried
+var ErrNoEndpoints = errors.New("no available endpoints")
+
+// default ejection settings of the multi-endpoint pools
+const (
+	defaultMaxFailures = 3
+	defaultCooldown    = 30 * time.Second
+)
+
+// endpoint is a backend address with its own pool
+type endpoint struct {
+	address      string
+	pool         Pool[net.Conn]
+	failures     int
+	ejectedUntil time.Time
+}
+
+// MultiPool is a pool of TCP connections over a set of backend addresses.
+// MultiPool selects an endpoint for each acquisition with its strategy and ejects endpoints after consecutive dial or health check failures.
+// Ejected endpoints are readmitted after the cooldown and ejected again on their first failure.
+type MultiPool struct {
+	limit     int
+	strategy  Strategy
+	opts      []Option
+	options   options
+	m         sync.Mutex
+	endpoints []*endpoint
+	owners    map[net.Conn]*endpoint
+	next      int
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+// compile time proof of interface implementation
+var _ Pool[net.Conn] = (*MultiPool)(nil)
+
+// NewMultiPool creates and returns a new multi-endpoint pool which keeps a pool of up to limit connections per address
+// opts are applied to the pool of each endpoint, WithEjection sets the ejection settings
+func NewMultiPool(addresses []string, limit int, strategy Strategy, opts ...Option) *MultiPool {
+	o := options{
+		maxFailures: defaultMaxFailures,
+		cooldown:    defaultCooldown,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	mp := &MultiPool{
+		limit:    limit,
+		strategy: strategy,
+		opts:     opts,
+		options:  o,
+		owners:   make(map[net.Conn]*endpoint),
+		closed:   make(chan struct{}),
+	}
+	mp.SetEndpoints(addresses)
+
+	return mp
+}
+
+// SetEndpoints replaces the endpoints, pools of the removed endpoints are closed once their connections are released
+// SetEndpoints does nothing after the pool is closed
+func (mp *MultiPool) SetEndpoints(addresses []string) {
+	mp.m.Lock()
+	defer mp.m.Unlock()
+
+	select {
+	case <-mp.closed:
+		return
+	default:
+	}
+
+	existing := make(map[string]*endpoint, len(mp.endpoints))
+	for _, e := range mp.endpoints {
+		existing[e.address] = e
+	}
+
+	endpoints := make([]*endpoint, 0, len(addresses))
+	for _, address := range addresses {
+		if e, ok := existing[address]; ok {
+			endpoints = append(endpoints, e)
+			delete(existing, address)
+			continue
+		}
+		endpoints = append(endpoints, mp.newEndpoint(address))
+	}
+	mp.endpoints = endpoints
+
+	for _, e := range existing {
+		go e.pool.Close(context.Background())
+	}
+}
+
+// Watch updates the endpoints with the addresses returned by resolve on every interval until the pool is closed.
+// Watch keeps the current endpoints if resolve fails.
+func (mp *MultiPool) Watch(resolve func(context.Context) ([]string, error), interval time.Duration) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	go func() {
+		defer cancel()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				addresses, err := resolve(ctx)
+				if err != nil {
+					continue
+				}
+				mp.SetEndpoints(addresses)
+			case <-mp.closed:
+				return
+			}
+		}
+	}()
+}
+
+// Acquire acquires a connection from the pool of an endpoint selected by the strategy.
+// Acquire tries the other endpoints if the selected endpoint fails or is exhausted.
+// Acquire returns ErrPoolExhausted if the available endpoints are exhausted and ErrNoEndpoints if there aren't any available endpoints.
+func (mp *MultiPool) Acquire(c context.Context) (net.Conn, error) {
+	select {
+	case <-mp.closed:
+		return nil, ErrPoolClosed
+	default:
+	}
+
+	tried := make(map[*endpoint]bool)
+	exhausted := false
+
+	for {
+		mp.m.Lock()
+		e := mp.selectEndpoint(tried)
+		mp.m.Unlock()
+
+		if e == nil {
+			if exhausted {
+				return nil, ErrPoolExhausted
+			}
+			return nil, ErrNoEndpoints
+		}
+		tried[e] = true
+
+		conn, err := e.pool.Acquire(c)
+		if err != nil {
+			// return the errors which aren't caused by the endpoint
+			if c.Err() != nil {
+				return nil, err
+			}
+			if errors.Is(err, ErrPoolClosed) {
+				continue
+			}
+			// busy endpoints aren't failed endpoints
+			if errors.Is(err, ErrPoolExhausted) {
+				exhausted = true
+				continue
+			}
+
+			mp.fail(e)
+			continue
+		}
+
+		mp.m.Lock()
+		e.failures = 0
+		mp.owners[conn] = e
+		mp.m.Unlock()
+
+		return conn, nil
+	}
+}
+
+// Release releases the connection back to the pool of its endpoint
+func (mp *MultiPool) Release(conn net.Conn) {
+	if e := mp.owner(conn); e != nil {
+		e.pool.Release(conn)
+	}
+}
+
+// Discard discards the connection from the pool of its endpoint
+func (mp *MultiPool) Discard(conn net.Conn) {
+	if e := mp.owner(conn); e != nil {
+		e.pool.Discard(conn)
+	}
+}
+
+// Close closes the pools of all endpoints and returns the first error
+func (mp *MultiPool) Close(c context.Context) error {
+	closed := false
+	mp.closeOnce.Do(func() {
+		mp.m.Lock()
+		close(mp.closed)
+		mp.m.Unlock()
+		closed = true
+	})
+	if !closed {
+		return ErrPoolClosed
+	}
+
+	mp.m.Lock()
+	endpoints := mp.endpoints
+	mp.m.Unlock()
+
+	var first error
+	for _, e := range endpoints {
+		if err := e.pool.Close(c); err != nil && first == nil {
+			first = err
+		}
+	}
+
+	return first
+}
+
+// SetLimit sets the maximum number of open connections per endpoint
+func (mp *MultiPool) SetLimit(n int) {
+	mp.m.Lock()
+	mp.limit = n
+	endpoints := mp.endpoints
+	mp.m.Unlock()
+
+	for _, e := range endpoints {
+		e.pool.SetLimit(n)
+	}
+}
+
+// Stats returns the sums of the statistics of the endpoints' pools
+func (mp *MultiPool) Stats() Stats {
+	var sum Stats
+	for _, s := range mp.EndpointStats() {
+		sum.add(s)
+	}
+
+	return sum
+}
+
+// Acquisitions returns the outstanding acquisitions of the endpoints' pools from the oldest to the newest
+func (mp *MultiPool) Acquisitions() []Acquisition {
+	mp.m.Lock()
+	endpoints := mp.endpoints
+	mp.m.Unlock()
+
+	var acquisitions []Acquisition
+	for _, e := range endpoints {
+		acquisitions = append(acquisitions, e.pool.Acquisitions()...)
+	}
+	sort.Slice(acquisitions, func(i, j int) bool {
+		return acquisitions[i].AcquiredAt.Before(acquisitions[j].AcquiredAt)
+	})
+
+	return acquisitions
+}
+
+// EndpointStats returns the statistics of the endpoints' pools by their addresses
+func (mp *MultiPool) EndpointStats() map[string]Stats {
+	mp.m.Lock()
+	endpoints := mp.endpoints
+	mp.m.Unlock()
+
+	stats := make(map[string]Stats, len(endpoints))
+	for _, e := range endpoints {
+		stats[e.address] = e.pool.Stats()
+	}
+
+	return stats
+}
+
+// newEndpoint creates an endpoint whose pool counts health check failures towards the ejection
+func (mp *MultiPool) newEndpoint(address string) *endpoint {
+	e := &endpoint{address: address}
+
+	opts := mp.opts
+	if healthCheck := mp.options.healthCheck; healthCheck != nil {
+		opts = append(opts[:len(opts):len(opts)], WithHealthCheck(func(conn net.Conn) error {
+			err := healthCheck(conn)
+			if err != nil {
+				mp.fail(e)
+			}
+			return err
+		}))
+	}
+
+	e.pool = NewPool(address, mp.limit, opts...)
+
+	return e
+}
+
+// fail counts a failure of the endpoint and ejects it after the max consecutive failures
+func (mp *MultiPool) fail(e *endpoint) {
+	mp.m.Lock()
+	defer mp.m.Unlock()
+
+	e.failures++
+	if e.failures >= mp.options.maxFailures {
+		e.ejectedUntil = time.Now().Add(mp.options.cooldown)
+	}
+}
+
+// owner returns and forgets the endpoint of the connection
+func (mp *MultiPool) owner(conn net.Conn) *endpoint {
+	mp.m.Lock()
+	defer mp.m.Unlock()
+
+	e := mp.owners[conn]
+	delete(mp.owners, conn)
+
+	return e
+}
+
+// selectEndpoint selects an endpoint which isn't ejected or tried with the strategy, it must be called with the mutex held
+func (mp *MultiPool) selectEndpoint(tried map[*endpoint]bool) *endpoint {
+	now := time.Now()
+
+	available := make([]*endpoint, 0, len(mp.endpoints))
+	for _, e := range mp.endpoints {
+		if !tried[e] && !now.Before(e.ejectedUntil) {
+			available = append(available, e)
+		}
+	}
+
+	if len(available) == 0 {
+		return nil
+	}
+
+	// prefer the endpoints with free connections or free space so an exhausted endpoint doesn't block the acquisition
+	free := make([]*endpoint, 0, len(available))
+	for _, e := range available {
+		if s := e.pool.Stats(); s.Idle > 0 || s.Open < s.MaxOpen {
+			free = append(free, e)
+		}
+	}
+	if len(free) > 0 {
+		available = free
+	}
+
+	switch mp.strategy {
+	case LeastInUse:
+		least := available[0]
+		for _, e := range available[1:] {
+			if e.pool.Stats().InUse < least.pool.Stats().InUse {
+				least = e
+			}
+		}
+		return least
+	case PowerOfTwoChoices:
+		if len(available) == 1 {
+			return available[0]
+		}
+		i := rand.Intn(len(available))
+		j := rand.Intn(len(available) - 1)
+		if j >= i {
+			j++
+		}
+		if available[j].pool.Stats().InUse < available[i].pool.Stats().InUse {
+			return available[j]
+		}
+		return available[i]
+	default:
+		mp.next++
+		return available[mp.next%len(available)]
+	}
+}
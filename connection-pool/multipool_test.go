@@ -0,0 +1,208 @@
+package pool
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// refused returns an address which refuses connections
+func refused(t *testing.T) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.Close()
+
+	return l.Addr().String()
+}
+
+func TestMultiPool(t *testing.T) {
+	healthy1, healthy2, broken := listen(t), listen(t), refused(t)
+
+	mp := NewMultiPool([]string{healthy1, healthy2, broken}, 2, RoundRobin, WithEjection(1, time.Minute))
+	defer mp.Close(context.Background())
+
+	// the broken endpoint should be ejected and the connections should be spread over the healthy endpoints
+	var conns []net.Conn
+	for i := 0; i < 4; i++ {
+		conn, err := mp.Acquire(context.Background())
+		assert.NoError(t, err)
+		conns = append(conns, conn)
+	}
+
+	stats := mp.EndpointStats()
+	assert.Equal(t, 2, stats[healthy1].InUse)
+	assert.Equal(t, 2, stats[healthy2].InUse)
+	assert.Equal(t, int64(1), stats[broken].DialErrors)
+
+	for _, conn := range conns {
+		mp.Release(conn)
+	}
+	assert.Equal(t, 4, mp.Stats().Idle)
+
+	// removed endpoints shouldn't be selected
+	mp.SetEndpoints([]string{healthy2})
+	conn, err := mp.Acquire(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, healthy2, conn.RemoteAddr().String())
+	mp.Release(conn)
+
+	// acquisitions should fail when all endpoints are ejected
+	mp.SetEndpoints([]string{broken})
+	_, err = mp.Acquire(context.Background())
+	assert.ErrorIs(t, err, ErrNoEndpoints)
+
+	// acquisitions should fail and the endpoints shouldn't change after closing
+	assert.NoError(t, mp.Close(context.Background()))
+	_, err = mp.Acquire(context.Background())
+	assert.ErrorIs(t, err, ErrPoolClosed)
+	mp.SetEndpoints([]string{healthy1})
+	assert.Equal(t, []string{broken}, func() []string {
+		var addresses []string
+		for address := range mp.EndpointStats() {
+			addresses = append(addresses, address)
+		}
+		return addresses
+	}())
+}
+
+func TestStrategies(t *testing.T) {
+	healthy1, healthy2 := listen(t), listen(t)
+
+	for _, strategy := range []Strategy{LeastInUse, PowerOfTwoChoices} {
+		mp := NewMultiPool([]string{healthy1, healthy2}, 2, strategy)
+
+		// the less loaded endpoint should be selected
+		conn1, err := mp.Acquire(context.Background())
+		assert.NoError(t, err)
+		conn2, err := mp.Acquire(context.Background())
+		assert.NoError(t, err)
+		assert.NotEqual(t, conn1.RemoteAddr(), conn2.RemoteAddr())
+
+		mp.Release(conn1)
+		mp.Release(conn2)
+		assert.NoError(t, mp.Close(context.Background()))
+	}
+}
+
+func TestExhaustedEndpoint(t *testing.T) {
+	mp := NewMultiPool([]string{listen(t)}, 1, RoundRobin, WithMaxWait(10*time.Millisecond), WithEjection(2, time.Minute))
+	defer mp.Close(context.Background())
+
+	conn, err := mp.Acquire(context.Background())
+	assert.NoError(t, err)
+
+	// acquisitions from the busy endpoint should fail without ejecting it
+	for i := 0; i < 2; i++ {
+		_, err = mp.Acquire(context.Background())
+		assert.ErrorIs(t, err, ErrPoolExhausted)
+	}
+
+	mp.Release(conn)
+	conn, err = mp.Acquire(context.Background())
+	assert.NoError(t, err)
+	mp.Release(conn)
+}
+
+func TestReadmission(t *testing.T) {
+	address := refused(t)
+
+	mp := NewMultiPool([]string{address}, 1, RoundRobin, WithEjection(1, 50*time.Millisecond))
+	defer mp.Close(context.Background())
+
+	// the endpoint should be ejected after the dial failure
+	_, err := mp.Acquire(context.Background())
+	assert.ErrorIs(t, err, ErrNoEndpoints)
+	_, err = mp.Acquire(context.Background())
+	assert.ErrorIs(t, err, ErrNoEndpoints)
+
+	// the recovered endpoint should be readmitted after the cooldown
+	l, err := net.Listen("tcp", address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	time.Sleep(50 * time.Millisecond)
+	conn, err := mp.Acquire(context.Background())
+	assert.NoError(t, err)
+	mp.Discard(conn)
+}
+
+func TestHealthCheckEjection(t *testing.T) {
+	var unhealthy atomic.Bool
+	mp := NewMultiPool([]string{listen(t)}, 1, RoundRobin, WithEjection(1, 50*time.Millisecond), WithHealthCheck(func(conn net.Conn) error {
+		if unhealthy.Load() {
+			return errors.New("unhealthy")
+		}
+		return nil
+	}))
+	defer mp.Close(context.Background())
+
+	conn, err := mp.Acquire(context.Background())
+	assert.NoError(t, err)
+	mp.Release(conn)
+
+	// the endpoint should be ejected after the failed health check of its idle connection
+	unhealthy.Store(true)
+	conn, err = mp.Acquire(context.Background())
+	assert.NoError(t, err)
+	mp.Release(conn)
+	_, err = mp.Acquire(context.Background())
+	assert.ErrorIs(t, err, ErrNoEndpoints)
+
+	// the endpoint should be readmitted after the cooldown
+	unhealthy.Store(false)
+	time.Sleep(50 * time.Millisecond)
+	conn, err = mp.Acquire(context.Background())
+	assert.NoError(t, err)
+	mp.Release(conn)
+}
+
+func TestWatch(t *testing.T) {
+	healthy1, healthy2 := listen(t), listen(t)
+
+	var m sync.Mutex
+	addresses, resolveErr := []string{healthy1}, error(nil)
+	resolve := func(context.Context) ([]string, error) {
+		m.Lock()
+		defer m.Unlock()
+
+		return addresses, resolveErr
+	}
+
+	mp := NewMultiPool([]string{healthy1}, 1, RoundRobin)
+	defer mp.Close(context.Background())
+	mp.Watch(resolve, 10*time.Millisecond)
+
+	endpoints := func() []string {
+		var endpoints []string
+		for address := range mp.EndpointStats() {
+			endpoints = append(endpoints, address)
+		}
+		return endpoints
+	}
+
+	// the endpoints should be updated with the resolved addresses
+	m.Lock()
+	addresses = []string{healthy2}
+	m.Unlock()
+	assert.Eventually(t, func() bool {
+		e := endpoints()
+		return len(e) == 1 && e[0] == healthy2
+	}, time.Second, 10*time.Millisecond)
+
+	// the endpoints should be kept when the resolution fails
+	m.Lock()
+	addresses, resolveErr = nil, errors.New("resolution error")
+	m.Unlock()
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, []string{healthy2}, endpoints())
+}
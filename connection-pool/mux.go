@@ -0,0 +1,574 @@
+package pool
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// frames of the multiplexing protocol have a 12 bytes header like yamux
+// version (1 byte), type (1 byte), flags (2 bytes), stream id (4 bytes) and length (4 bytes)
+// length is the length of the body of the data frames, the window increment of the window update frames and the opaque value of the ping frames
+const (
+	protoVersion = 0
+	headerSize   = 12
+)
+
+// frame types
+const (
+	typeData uint8 = iota
+	typeWindowUpdate
+	typePing
+	typeGoAway
+)
+
+// frame flags
+const (
+	flagSYN uint16 = 1 << iota
+	flagACK
+	flagFIN
+	flagRST
+)
+
+// initialWindow is the flow control window of a new stream before the window updates of its SYN and ACK frames
+const initialWindow = 256 * 1024
+
+// maxDataFrame is the maximum body length of the data frames sent by a session
+const maxDataFrame = 16 * 1024
+
+// default session configuration
+const (
+	defaultKeepAliveInterval = 30 * time.Second
+	defaultKeepAliveTimeout  = 10 * time.Second
+	defaultWriteTimeout      = 10 * time.Second
+	defaultAcceptBacklog     = 256
+)
+
+// errors of the sessions
+var (
+	ErrSessionClosed    = errors.New("session is closed")
+	ErrKeepAliveTimeout = errors.New("keepalive timeout")
+	ErrStreamReset      = errors.New("stream is reset")
+	errProtocol         = errors.New("protocol error")
+)
+
+// header is the header of a frame
+type header struct {
+	typ    uint8
+	flags  uint16
+	id     uint32
+	length uint32
+}
+
+// encode encodes the header into b
+func (h header) encode(b []byte) {
+	b[0] = protoVersion
+	b[1] = h.typ
+	binary.BigEndian.PutUint16(b[2:], h.flags)
+	binary.BigEndian.PutUint32(b[4:], h.id)
+	binary.BigEndian.PutUint32(b[8:], h.length)
+}
+
+// decodeHeader decodes a header from b
+func decodeHeader(b []byte) (header, error) {
+	if b[0] != protoVersion {
+		return header{}, errProtocol
+	}
+
+	return header{
+		typ:    b[1],
+		flags:  binary.BigEndian.Uint16(b[2:]),
+		id:     binary.BigEndian.Uint32(b[4:]),
+		length: binary.BigEndian.Uint32(b[8:]),
+	}, nil
+}
+
+// SessionConfig is the configuration of a session, zero fields are replaced by the defaults
+// WindowSize is the flow control window of each stream in bytes, it can't be less than 256KB
+// KeepAliveInterval is the interval between the keepalive pings, negative KeepAliveInterval disables the keepalive pings
+// KeepAliveTimeout is the duration after which a ping without a reply closes the session
+// WriteTimeout is the duration after which a blocked frame write closes the session
+// AcceptBacklog is the maximum number of the streams opened by the remote side which wait for AcceptStream
+type SessionConfig struct {
+	WindowSize        uint32
+	KeepAliveInterval time.Duration
+	KeepAliveTimeout  time.Duration
+	WriteTimeout      time.Duration
+	AcceptBacklog     int
+}
+
+// withDefaults returns the configuration with the defaults of the zero fields
+func (c SessionConfig) withDefaults() SessionConfig {
+	if c.WindowSize < initialWindow {
+		c.WindowSize = initialWindow
+	}
+	if c.KeepAliveInterval == 0 {
+		c.KeepAliveInterval = defaultKeepAliveInterval
+	}
+	if c.KeepAliveTimeout == 0 {
+		c.KeepAliveTimeout = defaultKeepAliveTimeout
+	}
+	if c.WriteTimeout == 0 {
+		c.WriteTimeout = defaultWriteTimeout
+	}
+	if c.AcceptBacklog == 0 {
+		c.AcceptBacklog = defaultAcceptBacklog
+	}
+
+	return c
+}
+
+// Session multiplexes streams over a connection with a yamux-style framing protocol.
+// Each stream has its own flow control window so a slow reader doesn't block the other streams.
+// Session pings the remote side periodically and closes itself if a ping isn't replied in time.
+type Session struct {
+	conn      net.Conn
+	config    SessionConfig
+	client    bool
+	writeM    sync.Mutex
+	m         sync.Mutex
+	nextID    uint32
+	streams   map[uint32]*Stream
+	accept    chan *Stream
+	pingID    uint32
+	pings     map[uint32]chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+	err       error
+}
+
+// compile time proof of interface implementation
+var _ net.Listener = (*Session)(nil)
+
+// Client creates and returns a new session on the client side of the connection
+func Client(conn net.Conn, config SessionConfig) *Session {
+	return newSession(conn, config, true)
+}
+
+// Server creates and returns a new session on the server side of the connection
+func Server(conn net.Conn, config SessionConfig) *Session {
+	return newSession(conn, config, false)
+}
+
+// newSession creates a session and starts receiving the frames and pinging the remote side
+// client sessions open streams with odd ids and server sessions open streams with even ids
+func newSession(conn net.Conn, config SessionConfig, client bool) *Session {
+	config = config.withDefaults()
+
+	s := &Session{
+		conn:    conn,
+		config:  config,
+		client:  client,
+		nextID:  2,
+		streams: make(map[uint32]*Stream),
+		accept:  make(chan *Stream, config.AcceptBacklog),
+		pings:   make(map[uint32]chan struct{}),
+		done:    make(chan struct{}),
+	}
+	if client {
+		s.nextID = 1
+	}
+
+	go s.receive()
+
+	if config.KeepAliveInterval > 0 {
+		go s.keepAlive()
+	}
+
+	return s
+}
+
+// Open opens a new stream
+func (s *Session) Open() (*Stream, error) {
+	s.m.Lock()
+	if s.isClosed() {
+		s.m.Unlock()
+		return nil, ErrSessionClosed
+	}
+	id := s.nextID
+	s.nextID += 2
+	st := newStream(s, id)
+	s.streams[id] = st
+	s.m.Unlock()
+
+	if err := s.writeFrame(header{typ: typeWindowUpdate, flags: flagSYN, id: id, length: s.config.WindowSize - initialWindow}, nil); err != nil {
+		s.remove(id)
+		return nil, err
+	}
+
+	return st, nil
+}
+
+// AcceptStream waits for and returns the next stream opened by the remote side
+func (s *Session) AcceptStream() (*Stream, error) {
+	select {
+	case st := <-s.accept:
+		return st, nil
+	case <-s.done:
+		return nil, ErrSessionClosed
+	}
+}
+
+// Accept waits for and returns the next stream opened by the remote side as a connection
+func (s *Session) Accept() (net.Conn, error) {
+	return s.AcceptStream()
+}
+
+// Addr returns the local address of the connection
+func (s *Session) Addr() net.Addr {
+	return s.conn.LocalAddr()
+}
+
+// NumStreams returns the number of the open streams
+func (s *Session) NumStreams() int {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	return len(s.streams)
+}
+
+// Ping pings the remote side and returns the round trip time
+func (s *Session) Ping() (time.Duration, error) {
+	replied := make(chan struct{})
+
+	s.m.Lock()
+	id := s.pingID
+	s.pingID++
+	s.pings[id] = replied
+	s.m.Unlock()
+
+	defer func() {
+		s.m.Lock()
+		delete(s.pings, id)
+		s.m.Unlock()
+	}()
+
+	start := time.Now()
+	if err := s.writeFrame(header{typ: typePing, flags: flagSYN, length: id}, nil); err != nil {
+		return 0, err
+	}
+
+	timer := time.NewTimer(s.config.KeepAliveTimeout)
+	defer timer.Stop()
+
+	select {
+	case <-replied:
+		return time.Since(start), nil
+	case <-timer.C:
+		return 0, ErrKeepAliveTimeout
+	case <-s.done:
+		return 0, ErrSessionClosed
+	}
+}
+
+// Done returns a channel which is closed when the session is closed
+func (s *Session) Done() <-chan struct{} {
+	return s.done
+}
+
+// Err returns the reason of closing the session, Err returns nil while the session is open
+func (s *Session) Err() error {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	return s.err
+}
+
+// Close tells the remote side that the session is going away and closes the session and its connection
+func (s *Session) Close() error {
+	if s.isClosed() {
+		return nil
+	}
+
+	s.writeFrame(header{typ: typeGoAway}, nil)
+	s.close(ErrSessionClosed)
+
+	return nil
+}
+
+// close closes the session and its connection once with the reason
+func (s *Session) close(err error) {
+	s.closeOnce.Do(func() {
+		s.m.Lock()
+		s.err = err
+		close(s.done)
+		s.m.Unlock()
+
+		s.conn.Close()
+	})
+}
+
+// isClosed reports whether the session is closed
+func (s *Session) isClosed() bool {
+	select {
+	case <-s.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// writeFrame writes the frame, writeFrame closes the session if the write fails
+func (s *Session) writeFrame(h header, body []byte) error {
+	if h.typ == typeData {
+		h.length = uint32(len(body))
+	}
+
+	frame := make([]byte, headerSize+len(body))
+	h.encode(frame)
+	copy(frame[headerSize:], body)
+
+	s.writeM.Lock()
+	defer s.writeM.Unlock()
+
+	if s.isClosed() {
+		return ErrSessionClosed
+	}
+
+	s.conn.SetWriteDeadline(time.Now().Add(s.config.WriteTimeout))
+	if _, err := s.conn.Write(frame); err != nil {
+		s.close(err)
+		return err
+	}
+
+	return nil
+}
+
+// receive reads and handles the frames until the session is closed
+func (s *Session) receive() {
+	b := make([]byte, headerSize)
+
+	for {
+		if _, err := io.ReadFull(s.conn, b); err != nil {
+			s.close(err)
+			return
+		}
+
+		h, err := decodeHeader(b)
+		if err == nil {
+			switch h.typ {
+			case typeData, typeWindowUpdate:
+				err = s.handleStream(h)
+			case typePing:
+				s.handlePing(h)
+			case typeGoAway:
+				err = ErrSessionClosed
+			default:
+				err = errProtocol
+			}
+		}
+
+		if err != nil {
+			s.close(err)
+			return
+		}
+	}
+}
+
+// handleStream handles a data frame or a window update frame
+func (s *Session) handleStream(h header) error {
+	var body []byte
+	if h.typ == typeData {
+		if h.length > s.config.WindowSize {
+			return errProtocol
+		}
+		body = make([]byte, h.length)
+		if _, err := io.ReadFull(s.conn, body); err != nil {
+			return err
+		}
+	}
+
+	// register the stream opened by the remote side and reply with the window update of this side
+	if h.flags&flagSYN != 0 {
+		if err := s.incoming(h.id); err != nil {
+			return err
+		}
+	}
+
+	s.m.Lock()
+	st := s.streams[h.id]
+	s.m.Unlock()
+
+	// ignore the frames of the removed streams
+	if st == nil {
+		return nil
+	}
+
+	if h.typ == typeWindowUpdate {
+		st.grow(h.length)
+	} else if !st.receive(body) {
+		return errProtocol
+	}
+
+	if h.flags&flagRST != 0 {
+		st.remoteReset()
+	} else if h.flags&flagFIN != 0 {
+		st.remoteClose()
+	}
+
+	return nil
+}
+
+// incoming registers a stream opened by the remote side and queues it for AcceptStream, the stream is reset if the backlog is full
+func (s *Session) incoming(id uint32) error {
+	// the remote side must open the streams with its own ids
+	if (id%2 == 1) == s.client {
+		return errProtocol
+	}
+
+	s.m.Lock()
+	if _, ok := s.streams[id]; ok {
+		s.m.Unlock()
+		return errProtocol
+	}
+	st := newStream(s, id)
+	s.streams[id] = st
+	s.m.Unlock()
+
+	select {
+	case s.accept <- st:
+		go s.writeFrame(header{typ: typeWindowUpdate, flags: flagACK, id: id, length: s.config.WindowSize - initialWindow}, nil)
+	default:
+		s.remove(id)
+		go s.writeFrame(header{typ: typeWindowUpdate, flags: flagRST, id: id}, nil)
+	}
+
+	return nil
+}
+
+// handlePing replies the ping requests and notifies the waiting pings of the replies
+func (s *Session) handlePing(h header) {
+	if h.flags&flagSYN != 0 {
+		go s.writeFrame(header{typ: typePing, flags: flagACK, length: h.length}, nil)
+		return
+	}
+
+	s.m.Lock()
+	replied, ok := s.pings[h.length]
+	delete(s.pings, h.length)
+	s.m.Unlock()
+
+	if ok {
+		close(replied)
+	}
+}
+
+// keepAlive pings the remote side on every keepalive interval and closes the session if a ping fails
+func (s *Session) keepAlive() {
+	ticker := time.NewTicker(s.config.KeepAliveInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if _, err := s.Ping(); err != nil {
+				s.close(err)
+				return
+			}
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// remove removes the stream
+func (s *Session) remove(id uint32) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	delete(s.streams, id)
+}
+
+// MuxPool opens streams over the connections of a pool.
+// MuxPool opens up to maxStreams streams per connection and acquires a new connection when all sessions are full,
+// connections of the closed sessions are discarded.
+type MuxPool struct {
+	pool       Pool[net.Conn]
+	maxStreams int
+	config     SessionConfig
+	m          sync.Mutex
+	sessions   map[*Session]net.Conn
+	closed     bool
+}
+
+// NewMuxPool creates and returns a new multiplexing pool over the connections of the pool
+func NewMuxPool(p Pool[net.Conn], maxStreams int, config SessionConfig) *MuxPool {
+	return &MuxPool{
+		pool:       p,
+		maxStreams: maxStreams,
+		config:     config,
+		sessions:   make(map[*Session]net.Conn),
+	}
+}
+
+// Open opens a stream on the session with the fewest streams, Open starts a new session if all sessions are full
+func (mp *MuxPool) Open(c context.Context) (net.Conn, error) {
+	for {
+		mp.m.Lock()
+		if mp.closed {
+			mp.m.Unlock()
+			return nil, ErrPoolClosed
+		}
+		var selected *Session
+		for s := range mp.sessions {
+			if n := s.NumStreams(); n < mp.maxStreams && (selected == nil || n < selected.NumStreams()) {
+				selected = s
+			}
+		}
+		mp.m.Unlock()
+
+		if selected != nil {
+			st, err := selected.Open()
+			// try again if the session is closed in the meantime
+			if err != nil {
+				continue
+			}
+			return st, nil
+		}
+
+		conn, err := mp.pool.Acquire(c)
+		if err != nil {
+			return nil, err
+		}
+
+		s := Client(conn, mp.config)
+		mp.m.Lock()
+		mp.sessions[s] = conn
+		mp.m.Unlock()
+
+		go mp.watch(s)
+	}
+}
+
+// Close closes the sessions, their connections are discarded from the pool
+func (mp *MuxPool) Close() error {
+	mp.m.Lock()
+	mp.closed = true
+	sessions := make([]*Session, 0, len(mp.sessions))
+	for s := range mp.sessions {
+		sessions = append(sessions, s)
+	}
+	mp.m.Unlock()
+
+	for _, s := range sessions {
+		s.Close()
+	}
+
+	return nil
+}
+
+// watch removes the session and discards its connection once the session is closed
+func (mp *MuxPool) watch(s *Session) {
+	<-s.Done()
+
+	mp.m.Lock()
+	conn := mp.sessions[s]
+	delete(mp.sessions, s)
+	mp.m.Unlock()
+
+	mp.pool.Discard(conn)
+}
@@ -0,0 +1,146 @@
+package pool
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// echo accepts the streams of the session and writes back what it reads
+func echo(s *Session) {
+	for {
+		st, err := s.AcceptStream()
+		if err != nil {
+			return
+		}
+		go func() {
+			io.Copy(st, st)
+			st.Close()
+		}()
+	}
+}
+
+func TestSession(t *testing.T) {
+	c1, c2 := net.Pipe()
+	client := Client(c1, SessionConfig{})
+	server := Server(c2, SessionConfig{})
+	defer client.Close()
+	go echo(server)
+
+	// streams should carry data over the window in both directions
+	data := bytes.Repeat([]byte("0123456789"), 100*1024)
+	done := make(chan struct{})
+	for i := 0; i < 3; i++ {
+		go func() {
+			defer func() { done <- struct{}{} }()
+
+			st, err := client.Open()
+			assert.NoError(t, err)
+			go func() {
+				st.Write(data)
+			}()
+			received := make([]byte, len(data))
+			_, err = io.ReadFull(st, received)
+			assert.NoError(t, err)
+			assert.Equal(t, data, received)
+			st.Close()
+		}()
+	}
+	for i := 0; i < 3; i++ {
+		<-done
+	}
+
+	// closed streams should be removed from both sides
+	assert.Eventually(t, func() bool {
+		return client.NumStreams() == 0 && server.NumStreams() == 0
+	}, time.Second, 10*time.Millisecond)
+
+	// closing the stream should end the reads of the remote side
+	st, err := client.Open()
+	assert.NoError(t, err)
+	_, err = st.Write([]byte("ping"))
+	assert.NoError(t, err)
+	assert.NoError(t, st.Close())
+	_, err = st.Read(make([]byte, 4))
+	assert.ErrorIs(t, err, net.ErrClosed)
+
+	// pings should be replied
+	rtt, err := client.Ping()
+	assert.NoError(t, err)
+	assert.Greater(t, rtt, time.Duration(0))
+
+	// closing the session should close the remote session
+	assert.NoError(t, client.Close())
+	<-server.Done()
+	_, err = server.AcceptStream()
+	assert.ErrorIs(t, err, ErrSessionClosed)
+}
+
+func TestKeepAlive(t *testing.T) {
+	c1, c2 := net.Pipe()
+	go io.Copy(io.Discard, c2)
+	defer c2.Close()
+
+	// the session should be closed when the remote side doesn't reply the pings
+	client := Client(c1, SessionConfig{KeepAliveInterval: 10 * time.Millisecond, KeepAliveTimeout: 10 * time.Millisecond})
+	select {
+	case <-client.Done():
+	case <-time.After(time.Second):
+		t.Fatal("session isn't closed")
+	}
+	assert.ErrorIs(t, client.Err(), ErrKeepAliveTimeout)
+}
+
+func TestMuxPool(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			s := Server(conn, SessionConfig{})
+			go echo(s)
+		}
+	}()
+
+	p := NewPool(l.Addr().String(), 2)
+	defer p.Close(context.Background())
+	mp := NewMuxPool(p, 2, SessionConfig{})
+
+	// streams should be spread over the sessions of the pool's connections
+	var streams []net.Conn
+	for i := 0; i < 4; i++ {
+		st, err := mp.Open(context.Background())
+		assert.NoError(t, err)
+		streams = append(streams, st)
+	}
+	assert.Equal(t, 2, p.Stats().InUse)
+
+	for _, st := range streams {
+		_, err := st.Write([]byte("hello"))
+		assert.NoError(t, err)
+		b := make([]byte, 5)
+		_, err = io.ReadFull(st, b)
+		assert.NoError(t, err)
+		assert.Equal(t, "hello", string(b))
+		st.Close()
+	}
+
+	// closing the multiplexing pool should discard the connections
+	assert.NoError(t, mp.Close())
+	assert.Eventually(t, func() bool {
+		return p.Stats().Open == 0
+	}, time.Second, 10*time.Millisecond)
+	_, err = mp.Open(context.Background())
+	assert.ErrorIs(t, err, ErrPoolClosed)
+}
@@ -0,0 +1,117 @@
+package pool
+
+import (
+	"fmt"
+	"time"
+)
+
+// Option configures a pool
+type Option func(*options)
+
+// options are the optional settings of a pool
+type options struct {
+	healthCheck    func(any) error
+	maxIdleTime    time.Duration
+	maxLifetime    time.Duration
+	maxIdle        int
+	minIdle        int
+	maxFailures    int
+	cooldown       time.Duration
+	maxWaiters     int
+	maxWait        time.Duration
+	leakThreshold  time.Duration
+	onLeak         func(Acquisition)
+	reclaimLeaks   bool
+	maxKeyIdleTime time.Duration
+	onClose        func(any)
+	onIdle         func()
+}
+
+// WithHealthCheck sets the function which checks idle resources before they are acquired.
+// Resources failing the health check are closed and discarded.
+// T must be the resource type of the pool, the resources of the other types fail the health check.
+func WithHealthCheck[T any](healthCheck func(T) error) Option {
+	return func(o *options) {
+		o.healthCheck = func(resource any) error {
+			r, ok := resource.(T)
+			if !ok {
+				return fmt.Errorf("health check of %T resources can't check %T resources", r, resource)
+			}
+			return healthCheck(r)
+		}
+	}
+}
+
+// WithMaxIdleTime sets the duration after which idle resources are closed, zero keeps idle resources forever
+func WithMaxIdleTime(d time.Duration) Option {
+	return func(o *options) {
+		o.maxIdleTime = d
+	}
+}
+
+// WithMaxLifetime sets the duration after which resources are closed once they are idle, zero keeps resources forever
+func WithMaxLifetime(d time.Duration) Option {
+	return func(o *options) {
+		o.maxLifetime = d
+	}
+}
+
+// WithMaxIdle sets the maximum number of idle resources, released resources over the maximum are closed, zero is no maximum
+func WithMaxIdle(n int) Option {
+	return func(o *options) {
+		o.maxIdle = n
+	}
+}
+
+// WithMinIdle sets the number of idle resources which the pool creates in the background at creation, after acquisitions and after discards.
+// Failed creations are retried with exponential backoff. The min idle is limited to the max idle if the max idle is set.
+func WithMinIdle(n int) Option {
+	return func(o *options) {
+		o.minIdle = n
+	}
+}
+
+// WithEjection sets the number of consecutive failures after which a multi-endpoint pool ejects an endpoint and the cooldown after which it readmits the endpoint
+func WithEjection(maxFailures int, cooldown time.Duration) Option {
+	return func(o *options) {
+		o.maxFailures = maxFailures
+		o.cooldown = cooldown
+	}
+}
+
+// WithMaxWaiters sets the maximum number of acquisitions waiting for a resource, Acquire returns ErrPoolExhausted over the maximum, zero is no maximum
+func WithMaxWaiters(n int) Option {
+	return func(o *options) {
+		o.maxWaiters = n
+	}
+}
+
+// WithMaxWait sets the duration after which a waiting acquisition returns ErrPoolExhausted, zero waits until the context is done
+func WithMaxWait(d time.Duration) Option {
+	return func(o *options) {
+		o.maxWait = d
+	}
+}
+
+// WithLeakDetection records the stack of each acquisition and reports the resources held longer than the threshold to onLeak once.
+// Recording the stacks is expensive, the leak detection is meant for debugging.
+func WithLeakDetection(threshold time.Duration, onLeak func(Acquisition)) Option {
+	return func(o *options) {
+		o.leakThreshold = threshold
+		o.onLeak = onLeak
+	}
+}
+
+// WithLeakReclaim makes the leak detection close the leaked resources and free their spaces, releasing a reclaimed resource does nothing
+func WithLeakReclaim() Option {
+	return func(o *options) {
+		o.reclaimLeaks = true
+	}
+}
+
+// WithMaxKeyIdleTime sets the duration after which a keyed pool closes and removes the sub-pool of a key which isn't used, zero keeps the sub-pools forever
+func WithMaxKeyIdleTime(d time.Duration) Option {
+	return func(o *options) {
+		o.maxKeyIdleTime = d
+	}
+}
@@ -1,53 +1,611 @@
 package pool
 
 import (
+	"container/list"
 	"context"
-	"net"
+	"errors"
+	"io"
+	"sync"
+	"time"
 )
 
-// Pool defines the basic behaviors of a connection pool
-type Pool interface {
-	Acquire(context.Context) (net.Conn, error)
-	Release(net.Conn)
+// Resource defines the constraints of the pooled resources, resources are tracked by their values and closed with Close
+type Resource interface {
+	comparable
+	io.Closer
 }
 
-type token struct{}
+// Factory creates a new resource, it should stop creating the resource when the context is done
+type Factory[T Resource] func(context.Context) (T, error)
 
-type pool struct {
-	address         string
-	semaphore       chan *token
-	idleConnections chan net.Conn
+// Pool defines the basic behaviors of a resource pool
+type Pool[T Resource] interface {
+	Acquire(context.Context) (T, error)
+	Release(T)
+	Discard(T)
+	Close(context.Context) error
+	SetLimit(int)
+	Stats() Stats
+	Acquisitions() []Acquisition
+}
+
+// ErrPoolClosed is returned by Acquire and Close after the pool is closed
+var ErrPoolClosed = errors.New("pool is closed")
+
+// ErrPoolExhausted is returned by Acquire when the pool has the max number of waiters or the max wait duration passes
+var ErrPoolExhausted = errors.New("pool is exhausted")
+
+// resourceState keeps the timestamps of an open resource and the acquisition of the resource in use
+type resourceState struct {
+	createdAt  time.Time
+	idleSince  time.Time
+	acquiredAt time.Time
+	stack      string
+	leaked     bool
+}
+
+// grant is handed to an acquisition, it is either a resource, a space for a new resource or an error
+type grant[T Resource] struct {
+	resource T
+	create   bool
+	err      error
+}
+
+// waiter is an acquisition waiting in the queue, grants is buffered so the pool hands the grant without blocking
+type waiter[T Resource] struct {
+	grants chan grant[T]
+}
+
+type pool[T Resource] struct {
+	factory   Factory[T]
+	options   options
+	m         sync.Mutex
+	limit     int
+	open      int
+	idle      []T
+	resources map[T]*resourceState
+	waiters   *list.List
+	closed    chan struct{}
+	drained   chan struct{}
+	closeOnce sync.Once
+	stats     Stats
+	refill    chan struct{}
 }
 
 // compile time proof of interface implementation
-var _ Pool = (*pool)(nil)
+var _ Pool[io.Closer] = (*pool[io.Closer])(nil)
+
+// New creates and returns a new resource pool which creates up to limit resources with the factory
+// New starts a reaper which closes expired idle resources if the max idle time or the max lifetime is set
+// New starts a filler which creates the min idle resources in the background if the min idle is set
+// New starts a leak detector which reports the resources held longer than the leak threshold if the leak detection is enabled
+func New[T Resource](factory Factory[T], limit int, opts ...Option) Pool[T] {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
 
-// NewPool creates and returns a new connection pool
-func NewPool(address string, limit int) Pool {
-	semaphore := make(chan *token, limit)
-	idleConnections := make(chan net.Conn, limit)
-	return &pool{address, semaphore, idleConnections}
+	// the idle resources over the max idle would be closed as soon as they are created
+	if o.maxIdle > 0 && o.minIdle > o.maxIdle {
+		o.minIdle = o.maxIdle
+	}
+
+	p := &pool[T]{
+		factory:   factory,
+		options:   o,
+		limit:     limit,
+		resources: make(map[T]*resourceState),
+		waiters:   list.New(),
+		closed:    make(chan struct{}),
+		drained:   make(chan struct{}),
+		refill:    make(chan struct{}, 1),
+	}
+
+	if interval := p.reapInterval(); interval > 0 {
+		go p.reap(interval)
+	}
+
+	if p.options.minIdle > 0 {
+		go p.fill()
+	}
+
+	if p.options.leakThreshold > 0 {
+		go p.detectLeaks(tickInterval(p.options.leakThreshold))
+	}
+
+	return p
 }
 
-// Acquire acquires an idle connection from the pool
-func (p *pool) Acquire(c context.Context) (net.Conn, error) {
-	// get an idle connection or create a new connection if semaphore has enough space
-	select {
-	case connection := <-p.idleConnections:
-		return connection, nil
-	case p.semaphore <- &token{}:
-		conn, err := net.Dial("tcp", p.address)
+// Acquire acquires an idle resource from the pool or creates a new resource if the pool has enough space.
+// Acquire waits in a FIFO queue while the pool is exhausted, released resources and freed spaces are handed to the waiters in order.
+// Acquire returns ErrPoolClosed after the pool is closed and ErrPoolExhausted if the pool has the max number of waiters or the max wait duration passes.
+func (p *pool[T]) Acquire(c context.Context) (T, error) {
+	var zero T
+
+	for {
+		g, err := p.take(c)
 		if err != nil {
-			<-p.semaphore
-			return nil, err
+			return zero, err
+		}
+
+		// create a new resource in the granted space
+		if g.create {
+			resource, err := p.create(c)
+			if err == nil {
+				p.acquired(resource)
+			}
+			return resource, err
+		}
+
+		// try again if the resource is discarded
+		if !p.check(g.resource) {
+			continue
+		}
+		p.acquired(g.resource)
+		p.wakeFiller()
+		return g.resource, nil
+	}
+}
+
+// check discards the taken resource and reports false if it is expired or it fails the health check
+func (p *pool[T]) check(resource T) bool {
+	if reason, expired := p.expiry(resource, time.Now()); expired {
+		p.discard(resource, reason)
+		return false
+	}
+
+	if p.options.healthCheck != nil && p.options.healthCheck(resource) != nil {
+		p.discard(resource, closedByHealthCheck)
+		return false
+	}
+
+	return true
+}
+
+// acquireIdle acquires the resource if it is idle, acquireIdle reports false if the resource isn't idle or it is discarded
+func (p *pool[T]) acquireIdle(resource T) bool {
+	p.m.Lock()
+
+	i := -1
+	for j, idle := range p.idle {
+		if idle == resource {
+			i = j
+			break
+		}
+	}
+	if i < 0 || p.isClosed() {
+		p.m.Unlock()
+		return false
+	}
+	p.idle = append(p.idle[:i], p.idle[i+1:]...)
+	p.resources[resource].idleSince = time.Time{}
+	p.m.Unlock()
+
+	if !p.check(resource) {
+		return false
+	}
+	p.acquired(resource)
+	p.wakeFiller()
+
+	return true
+}
+
+// evictIdle closes the oldest idle resource, evictIdle reports false if there isn't any idle resource
+func (p *pool[T]) evictIdle() bool {
+	p.m.Lock()
+
+	if len(p.idle) == 0 {
+		p.m.Unlock()
+		return false
+	}
+	resource := p.idle[0]
+	p.idle = append(p.idle[:0], p.idle[1:]...)
+	p.m.Unlock()
+
+	p.discard(resource, closedByMaxIdle)
+
+	return true
+}
+
+// take takes an idle resource or a space for a new resource, take waits in the queue and counts the wait if neither is available
+func (p *pool[T]) take(c context.Context) (grant[T], error) {
+	p.m.Lock()
+
+	if p.isClosed() {
+		p.m.Unlock()
+		return grant[T]{}, ErrPoolClosed
+	}
+
+	// serve the waiters first so new acquisitions don't overtake them
+	if p.waiters.Len() == 0 {
+		if n := len(p.idle); n > 0 {
+			resource := p.idle[n-1]
+			p.idle = p.idle[:n-1]
+			if s, ok := p.resources[resource]; ok {
+				s.idleSince = time.Time{}
+			}
+			p.m.Unlock()
+			return grant[T]{resource: resource}, nil
+		}
+
+		if p.open < p.limit {
+			p.open++
+			p.m.Unlock()
+			return grant[T]{create: true}, nil
+		}
+	}
+
+	if p.options.maxWaiters > 0 && p.waiters.Len() >= p.options.maxWaiters {
+		p.m.Unlock()
+		return grant[T]{}, ErrPoolExhausted
+	}
+
+	w := &waiter[T]{grants: make(chan grant[T], 1)}
+	e := p.waiters.PushBack(w)
+	p.m.Unlock()
+
+	start := time.Now()
+	defer func() {
+		p.m.Lock()
+		p.stats.WaitCount++
+		p.stats.WaitDuration += time.Since(start)
+		p.m.Unlock()
+	}()
+
+	var timeout <-chan time.Time
+	if p.options.maxWait > 0 {
+		timer := time.NewTimer(p.options.maxWait)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	select {
+	case g := <-w.grants:
+		return g, g.err
+	case <-c.Done():
+		return grant[T]{}, p.leave(w, e, c.Err())
+	case <-timeout:
+		return grant[T]{}, p.leave(w, e, ErrPoolExhausted)
+	}
+}
+
+// leave removes the waiter from the queue and returns err, leave gives the grant back if it is handed in the meantime
+func (p *pool[T]) leave(w *waiter[T], e *list.Element, err error) error {
+	p.m.Lock()
+
+	select {
+	case g := <-w.grants:
+		if g.create {
+			p.free()
+		}
+		p.m.Unlock()
+		if g.err == nil && !g.create {
+			p.put(g.resource)
+		}
+	default:
+		p.waiters.Remove(e)
+		p.m.Unlock()
+	}
+
+	return err
+}
+
+// create creates a new resource in the granted space
+func (p *pool[T]) create(c context.Context) (T, error) {
+	var zero T
+
+	resource, err := p.factory(c)
+	if err != nil {
+		p.m.Lock()
+		p.stats.DialErrors++
+		p.free()
+		p.m.Unlock()
+		return zero, err
+	}
+
+	p.m.Lock()
+	p.resources[resource] = &resourceState{createdAt: time.Now()}
+	p.m.Unlock()
+
+	// discard the new resource if the pool is closed while creating it
+	if p.isClosed() {
+		p.Discard(resource)
+		return zero, ErrPoolClosed
+	}
+
+	return resource, nil
+}
+
+// Release releases the resource back to the pool, the resource is handed to the first waiter if there is any
+// Release discards the resource if the pool is closed, it is over its max lifetime or the pool has the max number of idle resources
+func (p *pool[T]) Release(resource T) {
+	if p.isClosed() {
+		p.Discard(resource)
+		return
+	}
+
+	if reason, expired := p.expiry(resource, time.Now()); expired {
+		p.discard(resource, reason)
+		return
+	}
+
+	p.put(resource)
+}
+
+// put hands the resource to the first waiter or keeps it idle
+func (p *pool[T]) put(resource T) {
+	p.m.Lock()
+
+	// discard the resource if the pool is closed while releasing
+	if p.isClosed() {
+		p.m.Unlock()
+		p.Discard(resource)
+		return
+	}
+
+	// close the resources which aren't tracked by the pool like the reclaimed leaks
+	s, ok := p.resources[resource]
+	if !ok {
+		p.m.Unlock()
+		resource.Close()
+		return
+	}
+	s.acquiredAt = time.Time{}
+	s.stack = ""
+
+	// close the surplus resources after the limit is decreased
+	if p.open > p.limit {
+		p.m.Unlock()
+		p.discard(resource, closedByMaxIdle)
+		return
+	}
+
+	if e := p.waiters.Front(); e != nil {
+		p.waiters.Remove(e)
+		e.Value.(*waiter[T]).grants <- grant[T]{resource: resource}
+		p.m.Unlock()
+		return
+	}
+
+	if p.options.maxIdle > 0 && len(p.idle) >= p.options.maxIdle {
+		p.m.Unlock()
+		p.discard(resource, closedByMaxIdle)
+		return
+	}
+
+	s.idleSince = time.Now()
+	p.idle = append(p.idle, resource)
+	p.m.Unlock()
+
+	if p.options.onIdle != nil {
+		p.options.onIdle()
+	}
+}
+
+// Discard closes the resource and frees its space in the pool, it should be called instead of Release for broken resources
+func (p *pool[T]) Discard(resource T) {
+	p.discard(resource, closedByCaller)
+}
+
+// discard closes the resource, frees its space in the pool and counts the reason
+func (p *pool[T]) discard(resource T, reason closeReason) {
+	resource.Close()
+
+	p.m.Lock()
+	_, ok := p.resources[resource]
+	if ok {
+		delete(p.resources, resource)
+		p.stats.count(reason)
+		p.free()
+	}
+	p.m.Unlock()
+
+	if ok && p.options.onClose != nil {
+		p.options.onClose(resource)
+	}
+
+	p.wakeFiller()
+}
+
+// free frees a space in the pool and hands it to the first waiter, it must be called with the mutex held
+func (p *pool[T]) free() {
+	p.open--
+
+	if e := p.waiters.Front(); e != nil && p.open < p.limit {
+		p.waiters.Remove(e)
+		p.open++
+		e.Value.(*waiter[T]).grants <- grant[T]{create: true}
+	}
+
+	p.signalDrained()
+}
+
+// SetLimit sets the maximum number of open resources, the new spaces are handed to the waiters if the limit is increased.
+// SetLimit closes the surplus idle resources if the limit is decreased, resources in use are closed once they are released until the pool is in the limit.
+func (p *pool[T]) SetLimit(n int) {
+	p.m.Lock()
+
+	p.limit = n
+	for p.open < p.limit {
+		e := p.waiters.Front()
+		if e == nil {
+			break
 		}
-		return conn, err
+		p.waiters.Remove(e)
+		p.open++
+		e.Value.(*waiter[T]).grants <- grant[T]{create: true}
+	}
+
+	// take the oldest idle resources out
+	surplus := p.open - p.limit
+	if surplus > len(p.idle) {
+		surplus = len(p.idle)
+	}
+	var idle []T
+	if surplus > 0 {
+		idle = append(idle, p.idle[:surplus]...)
+		p.idle = append(p.idle[:0], p.idle[surplus:]...)
+	}
+	p.m.Unlock()
+
+	for _, resource := range idle {
+		p.discard(resource, closedByMaxIdle)
+	}
+
+	p.wakeFiller()
+}
+
+// Close closes the pool, idle resources are closed immediately and resources in use are closed once they are released.
+// Close fails the waiting acquisitions with ErrPoolClosed.
+// Close waits for the resources in use to be released and closes them forcibly when the context is done.
+func (p *pool[T]) Close(c context.Context) error {
+	closed := false
+	p.closeOnce.Do(func() {
+		p.m.Lock()
+		close(p.closed)
+		for e := p.waiters.Front(); e != nil; e = e.Next() {
+			e.Value.(*waiter[T]).grants <- grant[T]{err: ErrPoolClosed}
+		}
+		p.waiters.Init()
+		idle := p.idle
+		p.idle = nil
+		p.signalDrained()
+		p.m.Unlock()
+
+		for _, resource := range idle {
+			p.Discard(resource)
+		}
+		closed = true
+	})
+	if !closed {
+		return ErrPoolClosed
+	}
+
+	// check the drained pool first since select chooses randomly among the ready cases
+	select {
+	case <-p.drained:
+		return nil
+	default:
+	}
+
+	select {
+	case <-p.drained:
+		return nil
 	case <-c.Done():
-		return nil, c.Err()
 	}
+
+	// close the resources which aren't released in time, their owners still release or discard them later
+	p.m.Lock()
+	for resource := range p.resources {
+		resource.Close()
+	}
+	p.m.Unlock()
+
+	return c.Err()
+}
+
+// isClosed reports whether the pool is closed
+func (p *pool[T]) isClosed() bool {
+	select {
+	case <-p.closed:
+		return true
+	default:
+		return false
+	}
+}
+
+// signalDrained closes the drained channel once the closed pool has no open resources, it must be called with the mutex held
+func (p *pool[T]) signalDrained() {
+	if !p.isClosed() || p.open > 0 {
+		return
+	}
+
+	select {
+	case <-p.drained:
+	default:
+		close(p.drained)
+	}
+}
+
+// expiry reports whether and why the resource is expired, it is over its max lifetime or the idle resource is over its max idle time
+func (p *pool[T]) expiry(resource T, now time.Time) (closeReason, bool) {
+	p.m.Lock()
+	defer p.m.Unlock()
+
+	return p.expiryLocked(resource, now)
+}
+
+// expiryLocked is expiry which must be called with the mutex held
+func (p *pool[T]) expiryLocked(resource T, now time.Time) (closeReason, bool) {
+	s, ok := p.resources[resource]
+	if !ok {
+		return closedByCaller, false
+	}
+
+	if p.options.maxLifetime > 0 && now.Sub(s.createdAt) >= p.options.maxLifetime {
+		return closedByMaxLifetime, true
+	}
+
+	if p.options.maxIdleTime > 0 && !s.idleSince.IsZero() && now.Sub(s.idleSince) >= p.options.maxIdleTime {
+		return closedByMaxIdleTime, true
+	}
+
+	return closedByCaller, false
+}
+
+// reapInterval returns the interval of the reaper, half of the shortest expiry duration or zero if there isn't any
+func (p *pool[T]) reapInterval() time.Duration {
+	interval := p.options.maxIdleTime
+	if interval == 0 || (p.options.maxLifetime > 0 && p.options.maxLifetime < interval) {
+		interval = p.options.maxLifetime
+	}
+
+	if interval <= 0 {
+		return 0
+	}
+
+	return tickInterval(interval)
 }
 
-// Release releases the connection back to the pool
-func (p *pool) Release(c net.Conn) {
-	p.idleConnections <- c
+// tickInterval returns the interval of a background check of the duration, the interval is half of the duration and at least a millisecond
+func tickInterval(d time.Duration) time.Duration {
+	if d/2 < time.Millisecond {
+		return time.Millisecond
+	}
+
+	return d / 2
+}
+
+// reap closes the expired idle resources on every interval
+func (p *pool[T]) reap(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-p.closed:
+			return
+		}
+
+		// take the expired idle resources out and keep the others
+		now := time.Now()
+		expired := make(map[T]closeReason)
+
+		p.m.Lock()
+		idle := p.idle[:0]
+		for _, resource := range p.idle {
+			if reason, ok := p.expiryLocked(resource, now); ok {
+				expired[resource] = reason
+				continue
+			}
+			idle = append(idle, resource)
+		}
+		p.idle = idle
+		p.m.Unlock()
+
+		for resource, reason := range expired {
+			p.discard(resource, reason)
+		}
+	}
 }
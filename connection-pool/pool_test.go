@@ -0,0 +1,433 @@
+package pool
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// listen starts a TCP server which accepts and holds connections until the test ends
+func listen(t *testing.T) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan struct{})
+	t.Cleanup(func() {
+		l.Close()
+		<-done
+	})
+
+	go func() {
+		defer close(done)
+
+		var conns []net.Conn
+		defer func() {
+			for _, conn := range conns {
+				conn.Close()
+			}
+		}()
+
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			conns = append(conns, conn)
+		}
+	}()
+
+	return l.Addr().String()
+}
+
+func TestDiscard(t *testing.T) {
+	p := NewPool(listen(t), 1)
+
+	conn, err := p.Acquire(context.Background())
+	assert.NoError(t, err)
+
+	// discarding a connection must free its space in the pool
+	p.Discard(conn)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	conn, err = p.Acquire(ctx)
+	assert.NoError(t, err)
+	p.Release(conn)
+}
+
+func TestHealthCheck(t *testing.T) {
+	unhealthy := errors.New("unhealthy")
+	checked := 0
+	p := NewPool(listen(t), 1, WithHealthCheck(func(net.Conn) error {
+		checked++
+		return unhealthy
+	}))
+
+	conn, err := p.Acquire(context.Background())
+	assert.NoError(t, err)
+	p.Release(conn)
+
+	// unhealthy idle connections must be replaced with new connections
+	replacement, err := p.Acquire(context.Background())
+	assert.NoError(t, err)
+	assert.NotSame(t, conn, replacement)
+	assert.Equal(t, 1, checked)
+	p.Release(replacement)
+}
+
+func TestExpiry(t *testing.T) {
+	address := listen(t)
+
+	// the reaper must close idle connections over the max idle time and free their spaces
+	t.Run("max idle time", func(t *testing.T) {
+		p := NewPool(address, 1, WithMaxIdleTime(20*time.Millisecond))
+
+		conn, err := p.Acquire(context.Background())
+		assert.NoError(t, err)
+		p.Release(conn)
+
+		assert.Eventually(t, func() bool {
+			return p.Stats().Open == 0
+		}, time.Second, 10*time.Millisecond)
+	})
+
+	// connections over the max lifetime must be closed on release
+	t.Run("max lifetime", func(t *testing.T) {
+		p := NewPool(address, 1, WithMaxLifetime(20*time.Millisecond))
+
+		conn, err := p.Acquire(context.Background())
+		assert.NoError(t, err)
+		time.Sleep(20 * time.Millisecond)
+		p.Release(conn)
+
+		assert.Equal(t, 0, p.Stats().Open)
+	})
+
+	// released connections over the max number of idle connections must be closed
+	t.Run("max idle", func(t *testing.T) {
+		p := NewPool(address, 2, WithMaxIdle(1))
+
+		conn1, err := p.Acquire(context.Background())
+		assert.NoError(t, err)
+		conn2, err := p.Acquire(context.Background())
+		assert.NoError(t, err)
+		p.Release(conn1)
+		p.Release(conn2)
+
+		assert.Equal(t, 1, p.Stats().Open)
+		assert.Equal(t, 1, p.Stats().Idle)
+	})
+}
+
+func TestClose(t *testing.T) {
+	address := listen(t)
+
+	// closing must reject new acquisitions and wait for connections in use to be released
+	t.Run("graceful", func(t *testing.T) {
+		p := NewPool(address, 2)
+
+		idle, err := p.Acquire(context.Background())
+		assert.NoError(t, err)
+		inUse, err := p.Acquire(context.Background())
+		assert.NoError(t, err)
+		p.Release(idle)
+
+		closed := make(chan error)
+		go func() {
+			closed <- p.Close(context.Background())
+		}()
+
+		assert.Eventually(t, func() bool {
+			_, err := p.Acquire(context.Background())
+			return errors.Is(err, ErrPoolClosed)
+		}, time.Second, 10*time.Millisecond)
+
+		p.Release(inUse)
+		assert.NoError(t, <-closed)
+		assert.ErrorIs(t, p.Close(context.Background()), ErrPoolClosed)
+	})
+
+	// closing must close connections in use forcibly when the context is done
+	t.Run("forced", func(t *testing.T) {
+		p := NewPool(address, 1)
+
+		inUse, err := p.Acquire(context.Background())
+		assert.NoError(t, err)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+
+		assert.ErrorIs(t, p.Close(ctx), context.DeadlineExceeded)
+		_, err = inUse.Write([]byte("ping"))
+		assert.Error(t, err)
+		p.Release(inUse)
+	})
+}
+
+// session is a fake resource
+type session struct {
+	id     int
+	closed bool
+}
+
+func (s *session) Close() error {
+	s.closed = true
+	return nil
+}
+
+// newSessionPool creates a pool of sessions which is closed when the test ends
+func newSessionPool(t *testing.T, limit int, opts ...Option) Pool[*session] {
+	p := New(func(c context.Context) (*session, error) {
+		return &session{}, nil
+	}, limit, opts...)
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		p.Close(ctx)
+	})
+
+	return p
+}
+
+func TestFactory(t *testing.T) {
+	created := 0
+	p := New(func(c context.Context) (*session, error) {
+		created++
+		return &session{id: created}, c.Err()
+	}, 1)
+
+	// released resources should be reused
+	s1, err := p.Acquire(context.Background())
+	assert.NoError(t, err)
+	p.Release(s1)
+
+	s2, err := p.Acquire(context.Background())
+	assert.NoError(t, err)
+	assert.Same(t, s1, s2)
+
+	// discarded resources should be closed
+	p.Discard(s2)
+	assert.True(t, s2.closed)
+
+	// factory errors should free the space in the pool
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = p.Acquire(ctx)
+	assert.ErrorIs(t, err, context.Canceled)
+
+	s3, err := p.Acquire(context.Background())
+	assert.NoError(t, err)
+	p.Release(s3)
+
+	// closing should close idle resources
+	assert.NoError(t, p.Close(context.Background()))
+	assert.True(t, s3.closed)
+}
+
+func TestHealthCheckType(t *testing.T) {
+	p := newSessionPool(t, 1, WithHealthCheck(func(conn net.Conn) error {
+		return nil
+	}))
+
+	s1, err := p.Acquire(context.Background())
+	assert.NoError(t, err)
+	p.Release(s1)
+
+	// resources of the other types should fail the health check instead of panicking
+	s2, err := p.Acquire(context.Background())
+	assert.NoError(t, err)
+	assert.NotSame(t, s1, s2)
+	assert.True(t, s1.closed)
+	assert.Equal(t, int64(1), p.Stats().UnhealthyClosed)
+	p.Release(s2)
+}
+
+func TestStats(t *testing.T) {
+	p := newSessionPool(t, 2, WithHealthCheck(func(s *session) error {
+		return errors.New("unhealthy")
+	}))
+
+	s1, err := p.Acquire(context.Background())
+	assert.NoError(t, err)
+	s2, err := p.Acquire(context.Background())
+	assert.NoError(t, err)
+
+	// acquisitions from the exhausted pool should be counted as waits
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = p.Acquire(ctx)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	p.Release(s1)
+	stats := p.Stats()
+	assert.Equal(t, 2, stats.MaxOpen)
+	assert.Equal(t, 2, stats.Open)
+	assert.Equal(t, 1, stats.InUse)
+	assert.Equal(t, 1, stats.Idle)
+	assert.Equal(t, int64(1), stats.WaitCount)
+	assert.GreaterOrEqual(t, stats.WaitDuration, 10*time.Millisecond)
+
+	// unhealthy idle resources should be counted
+	s3, err := p.Acquire(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), p.Stats().UnhealthyClosed)
+	p.Release(s2)
+	p.Release(s3)
+
+	// statistics should be written in the Prometheus text format
+	var b strings.Builder
+	assert.NoError(t, WritePrometheus(&b, map[string]Stats{"sessions": p.Stats()}))
+	assert.Contains(t, b.String(), `pool_closed_total{pool="sessions",reason="unhealthy"} 1`)
+}
+
+func TestMinIdle(t *testing.T) {
+	var m sync.Mutex
+	failures := 1
+	p := New(func(c context.Context) (*session, error) {
+		m.Lock()
+		defer m.Unlock()
+
+		if failures > 0 {
+			failures--
+			return nil, errors.New("dial error")
+		}
+		return &session{}, nil
+	}, 3, WithMinIdle(2))
+	defer p.Close(context.Background())
+
+	// the pool should create the min idle resources in the background after retrying failed creations
+	assert.Eventually(t, func() bool {
+		return p.Stats().Idle == 2
+	}, time.Second, 10*time.Millisecond)
+	assert.Equal(t, int64(1), p.Stats().DialErrors)
+
+	// the pool should replace the discarded resources
+	s, err := p.Acquire(context.Background())
+	assert.NoError(t, err)
+	p.Discard(s)
+
+	assert.Eventually(t, func() bool {
+		return p.Stats().Idle == 2
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestMinIdleOverMaxIdle(t *testing.T) {
+	var m sync.Mutex
+	created := 0
+	p := New(func(c context.Context) (*session, error) {
+		m.Lock()
+		defer m.Unlock()
+
+		created++
+		return &session{}, nil
+	}, 3, WithMinIdle(2), WithMaxIdle(1))
+	defer p.Close(context.Background())
+
+	// the min idle should be limited to the max idle instead of creating and closing resources repeatedly
+	assert.Eventually(t, func() bool {
+		return p.Stats().Idle == 1
+	}, time.Second, 10*time.Millisecond)
+	time.Sleep(50 * time.Millisecond)
+
+	m.Lock()
+	assert.Equal(t, 1, created)
+	m.Unlock()
+	assert.Zero(t, p.Stats().MaxIdleClosed)
+}
+
+func TestWaiters(t *testing.T) {
+	p := newSessionPool(t, 1, WithMaxWaiters(3))
+
+	waiters := func() int {
+		pp := p.(*pool[*session])
+		pp.m.Lock()
+		defer pp.m.Unlock()
+
+		return pp.waiters.Len()
+	}
+
+	s, err := p.Acquire(context.Background())
+	assert.NoError(t, err)
+
+	// waiters should be served in their arrival order
+	order := make(chan int, 3)
+	for i := 0; i < 3; i++ {
+		go func(i int) {
+			s, err := p.Acquire(context.Background())
+			assert.NoError(t, err)
+			order <- i
+			p.Release(s)
+		}(i)
+		assert.Eventually(t, func() bool {
+			return waiters() == i+1
+		}, time.Second, time.Millisecond)
+	}
+
+	// acquisitions over the max number of waiters should fail immediately
+	_, err = p.Acquire(context.Background())
+	assert.ErrorIs(t, err, ErrPoolExhausted)
+
+	p.Release(s)
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, i, <-order)
+	}
+
+	// acquisitions should fail after the max wait duration
+	p2 := newSessionPool(t, 1, WithMaxWait(20*time.Millisecond))
+
+	s, err = p2.Acquire(context.Background())
+	assert.NoError(t, err)
+	_, err = p2.Acquire(context.Background())
+	assert.ErrorIs(t, err, ErrPoolExhausted)
+	assert.Equal(t, int64(1), p2.Stats().WaitCount)
+	p2.Release(s)
+}
+
+func TestSetLimit(t *testing.T) {
+	p := newSessionPool(t, 1)
+
+	s1, err := p.Acquire(context.Background())
+	assert.NoError(t, err)
+
+	// increasing the limit should hand the new space to the waiter
+	acquired := make(chan *session)
+	go func() {
+		s, err := p.Acquire(context.Background())
+		assert.NoError(t, err)
+		acquired <- s
+	}()
+	assert.Eventually(t, func() bool {
+		pp := p.(*pool[*session])
+		pp.m.Lock()
+		defer pp.m.Unlock()
+
+		return pp.waiters.Len() == 1
+	}, time.Second, time.Millisecond)
+	p.SetLimit(3)
+	s2 := <-acquired
+	s3, err := p.Acquire(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 3, p.Stats().Open)
+
+	// decreasing the limit should close the surplus idle resources
+	p.Release(s1)
+	p.SetLimit(1)
+	assert.True(t, s1.closed)
+	assert.Equal(t, 2, p.Stats().Open)
+
+	// released resources should be closed until the pool is in the limit
+	p.Release(s2)
+	assert.True(t, s2.closed)
+	p.Release(s3)
+	assert.False(t, s3.closed)
+	assert.Equal(t, 1, p.Stats().Idle)
+}
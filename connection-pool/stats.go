@@ -0,0 +1,147 @@
+package pool
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Stats are the statistics of a pool like the DBStats of database/sql
+// MaxOpen is the maximum number of open resources, Open is the sum of InUse and Idle
+// WaitCount and WaitDuration are the number and the total duration of the acquisitions which waited for a resource
+// MaxIdleClosed, MaxIdleTimeClosed, MaxLifetimeClosed, UnhealthyClosed and LeakedClosed are the numbers of resources closed by the pool for each reason
+// MaxIdleClosed includes the surplus resources closed after the limit is decreased
+// DialErrors is the number of errors returned by the factory
+type Stats struct {
+	MaxOpen           int           `json:"maxOpen"`
+	Open              int           `json:"open"`
+	InUse             int           `json:"inUse"`
+	Idle              int           `json:"idle"`
+	WaitCount         int64         `json:"waitCount"`
+	WaitDuration      time.Duration `json:"waitDuration"`
+	MaxIdleClosed     int64         `json:"maxIdleClosed"`
+	MaxIdleTimeClosed int64         `json:"maxIdleTimeClosed"`
+	MaxLifetimeClosed int64         `json:"maxLifetimeClosed"`
+	UnhealthyClosed   int64         `json:"unhealthyClosed"`
+	LeakedClosed      int64         `json:"leakedClosed"`
+	DialErrors        int64         `json:"dialErrors"`
+}
+
+// closeReason is the reason of closing a resource
+type closeReason int
+
+// reasons of closing resources
+const (
+	closedByCaller closeReason = iota
+	closedByMaxIdle
+	closedByMaxIdleTime
+	closedByMaxLifetime
+	closedByHealthCheck
+	closedByLeak
+)
+
+// count counts the closed resource by its reason
+func (s *Stats) count(reason closeReason) {
+	switch reason {
+	case closedByMaxIdle:
+		s.MaxIdleClosed++
+	case closedByMaxIdleTime:
+		s.MaxIdleTimeClosed++
+	case closedByMaxLifetime:
+		s.MaxLifetimeClosed++
+	case closedByHealthCheck:
+		s.UnhealthyClosed++
+	case closedByLeak:
+		s.LeakedClosed++
+	}
+}
+
+// add adds the statistics to the sums
+func (s *Stats) add(o Stats) {
+	s.MaxOpen += o.MaxOpen
+	s.Open += o.Open
+	s.InUse += o.InUse
+	s.Idle += o.Idle
+	s.WaitCount += o.WaitCount
+	s.WaitDuration += o.WaitDuration
+	s.MaxIdleClosed += o.MaxIdleClosed
+	s.MaxIdleTimeClosed += o.MaxIdleTimeClosed
+	s.MaxLifetimeClosed += o.MaxLifetimeClosed
+	s.UnhealthyClosed += o.UnhealthyClosed
+	s.LeakedClosed += o.LeakedClosed
+	s.DialErrors += o.DialErrors
+}
+
+// Stats returns the statistics of the pool
+func (p *pool[T]) Stats() Stats {
+	p.m.Lock()
+	defer p.m.Unlock()
+
+	s := p.stats
+	s.MaxOpen = p.limit
+	s.Open = len(p.resources)
+	s.Idle = len(p.idle)
+	s.InUse = s.Open - s.Idle
+	if s.InUse < 0 {
+		s.InUse = 0
+	}
+
+	return s
+}
+
+// labelEscaper escapes label values in the Prometheus text format
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// WritePrometheus writes the statistics of the pools by their names in the Prometheus text format
+func WritePrometheus(w io.Writer, pools map[string]Stats) error {
+	names := make([]string, 0, len(pools))
+	for name := range pools {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+
+	// family writes the header of a metric and a sample of each pool
+	family := func(metric, kind, help string, sample func(name string, s Stats)) {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s %s\n", metric, help, metric, kind)
+		for _, name := range names {
+			sample(labelEscaper.Replace(name), pools[name])
+		}
+	}
+
+	gauge := func(metric, help string, value func(Stats) int) {
+		family(metric, "gauge", help, func(name string, s Stats) {
+			fmt.Fprintf(&b, "%s{pool=\"%s\"} %d\n", metric, name, value(s))
+		})
+	}
+	gauge("pool_max_open", "Maximum number of open resources.", func(s Stats) int { return s.MaxOpen })
+	gauge("pool_open", "Number of open resources.", func(s Stats) int { return s.Open })
+	gauge("pool_in_use", "Number of resources in use.", func(s Stats) int { return s.InUse })
+	gauge("pool_idle", "Number of idle resources.", func(s Stats) int { return s.Idle })
+
+	family("pool_wait_count_total", "counter", "Acquisitions which waited for a resource.", func(name string, s Stats) {
+		fmt.Fprintf(&b, "pool_wait_count_total{pool=\"%s\"} %d\n", name, s.WaitCount)
+	})
+	family("pool_wait_seconds_total", "counter", "Time spent waiting for resources.", func(name string, s Stats) {
+		fmt.Fprintf(&b, "pool_wait_seconds_total{pool=\"%s\"} %g\n", name, s.WaitDuration.Seconds())
+	})
+
+	family("pool_closed_total", "counter", "Resources closed by the pool by reason.", func(name string, s Stats) {
+		fmt.Fprintf(&b, "pool_closed_total{pool=\"%s\",reason=\"max_idle\"} %d\n", name, s.MaxIdleClosed)
+		fmt.Fprintf(&b, "pool_closed_total{pool=\"%s\",reason=\"max_idle_time\"} %d\n", name, s.MaxIdleTimeClosed)
+		fmt.Fprintf(&b, "pool_closed_total{pool=\"%s\",reason=\"max_lifetime\"} %d\n", name, s.MaxLifetimeClosed)
+		fmt.Fprintf(&b, "pool_closed_total{pool=\"%s\",reason=\"unhealthy\"} %d\n", name, s.UnhealthyClosed)
+		fmt.Fprintf(&b, "pool_closed_total{pool=\"%s\",reason=\"leaked\"} %d\n", name, s.LeakedClosed)
+	})
+
+	family("pool_dial_errors_total", "counter", "Errors returned by the factory.", func(name string, s Stats) {
+		fmt.Fprintf(&b, "pool_dial_errors_total{pool=\"%s\"} %d\n", name, s.DialErrors)
+	})
+
+	_, err := io.WriteString(w, b.String())
+
+	return err
+}
@@ -0,0 +1,291 @@
+package pool
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// Stream is a logical connection multiplexed over a session
+type Stream struct {
+	id            uint32
+	session       *Session
+	m             sync.Mutex
+	buffer        bytes.Buffer
+	recvWindow    uint32
+	consumed      uint32
+	sendWindow    uint32
+	closed        bool
+	remoteClosed  bool
+	reset         bool
+	readDeadline  time.Time
+	writeDeadline time.Time
+	readable      chan struct{}
+	writable      chan struct{}
+}
+
+// compile time proof of interface implementation
+var _ net.Conn = (*Stream)(nil)
+
+// newStream creates a stream with the window of the session and the initial window of the remote side
+func newStream(s *Session, id uint32) *Stream {
+	return &Stream{
+		id:         id,
+		session:    s,
+		recvWindow: s.config.WindowSize,
+		sendWindow: initialWindow,
+		readable:   make(chan struct{}, 1),
+		writable:   make(chan struct{}, 1),
+	}
+}
+
+// ID returns the id of the stream
+func (st *Stream) ID() uint32 {
+	return st.id
+}
+
+// Read reads the data received from the remote side, Read returns io.EOF after the remote side closes the stream
+func (st *Stream) Read(b []byte) (int, error) {
+	for {
+		st.m.Lock()
+
+		if st.closed {
+			st.m.Unlock()
+			return 0, net.ErrClosed
+		}
+
+		if st.buffer.Len() > 0 {
+			n, _ := st.buffer.Read(b)
+
+			// update the window of the remote side after half of the window is consumed
+			st.consumed += uint32(n)
+			var increment uint32
+			if st.consumed >= st.session.config.WindowSize/2 {
+				increment = st.consumed
+				st.recvWindow += increment
+				st.consumed = 0
+			}
+			st.m.Unlock()
+
+			if increment > 0 {
+				st.session.writeFrame(header{typ: typeWindowUpdate, id: st.id, length: increment}, nil)
+			}
+			return n, nil
+		}
+
+		if st.reset {
+			st.m.Unlock()
+			return 0, ErrStreamReset
+		}
+
+		if st.remoteClosed {
+			st.m.Unlock()
+			return 0, io.EOF
+		}
+
+		deadline := st.readDeadline
+		st.m.Unlock()
+
+		if err := st.wait(st.readable, deadline); err != nil {
+			return 0, err
+		}
+	}
+}
+
+// Write writes the data to the remote side, Write blocks while the window of the remote side is full
+func (st *Stream) Write(b []byte) (int, error) {
+	written := 0
+
+	for written < len(b) {
+		st.m.Lock()
+
+		if st.closed {
+			st.m.Unlock()
+			return written, net.ErrClosed
+		}
+
+		if st.reset {
+			st.m.Unlock()
+			return written, ErrStreamReset
+		}
+
+		if st.sendWindow == 0 {
+			deadline := st.writeDeadline
+			st.m.Unlock()
+
+			if err := st.wait(st.writable, deadline); err != nil {
+				return written, err
+			}
+			continue
+		}
+
+		n := len(b) - written
+		if n > int(st.sendWindow) {
+			n = int(st.sendWindow)
+		}
+		if n > maxDataFrame {
+			n = maxDataFrame
+		}
+		st.sendWindow -= uint32(n)
+		st.m.Unlock()
+
+		if err := st.session.writeFrame(header{typ: typeData, id: st.id}, b[written:written+n]); err != nil {
+			return written, err
+		}
+		written += n
+	}
+
+	return written, nil
+}
+
+// wait waits for the notification, the deadline or the closing of the session
+func (st *Stream) wait(notify chan struct{}, deadline time.Time) error {
+	var timeout <-chan time.Time
+	if !deadline.IsZero() {
+		timer := time.NewTimer(time.Until(deadline))
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	select {
+	case <-notify:
+		return nil
+	case <-timeout:
+		return os.ErrDeadlineExceeded
+	case <-st.session.done:
+		return ErrSessionClosed
+	}
+}
+
+// Close closes the stream and tells the remote side that no more data will be sent
+func (st *Stream) Close() error {
+	st.m.Lock()
+	if st.closed {
+		st.m.Unlock()
+		return nil
+	}
+	st.closed = true
+	remove := st.remoteClosed || st.reset
+	reset := st.reset
+	st.m.Unlock()
+
+	st.notify()
+
+	if remove {
+		st.session.remove(st.id)
+	}
+	if !reset {
+		return st.session.writeFrame(header{typ: typeWindowUpdate, flags: flagFIN, id: st.id}, nil)
+	}
+
+	return nil
+}
+
+// LocalAddr returns the local address of the session's connection
+func (st *Stream) LocalAddr() net.Addr {
+	return st.session.conn.LocalAddr()
+}
+
+// RemoteAddr returns the remote address of the session's connection
+func (st *Stream) RemoteAddr() net.Addr {
+	return st.session.conn.RemoteAddr()
+}
+
+// SetDeadline sets the read and the write deadlines
+func (st *Stream) SetDeadline(t time.Time) error {
+	st.SetReadDeadline(t)
+	st.SetWriteDeadline(t)
+
+	return nil
+}
+
+// SetReadDeadline sets the deadline of the pending and the future reads
+func (st *Stream) SetReadDeadline(t time.Time) error {
+	st.m.Lock()
+	st.readDeadline = t
+	st.m.Unlock()
+
+	signal(st.readable)
+
+	return nil
+}
+
+// SetWriteDeadline sets the deadline of the pending and the future writes
+func (st *Stream) SetWriteDeadline(t time.Time) error {
+	st.m.Lock()
+	st.writeDeadline = t
+	st.m.Unlock()
+
+	signal(st.writable)
+
+	return nil
+}
+
+// receive buffers the data received from the remote side, receive reports false if the data exceeds the window
+func (st *Stream) receive(data []byte) bool {
+	st.m.Lock()
+	defer st.m.Unlock()
+
+	if uint32(len(data)) > st.recvWindow {
+		return false
+	}
+	st.recvWindow -= uint32(len(data))
+
+	// drop the data of the closed streams without buffering it
+	if !st.closed {
+		st.buffer.Write(data)
+	}
+	signal(st.readable)
+
+	return true
+}
+
+// grow increases the window of the remote side
+func (st *Stream) grow(increment uint32) {
+	st.m.Lock()
+	st.sendWindow += increment
+	st.m.Unlock()
+
+	signal(st.writable)
+}
+
+// remoteClose marks the stream closed by the remote side and removes the stream if it is closed by this side too
+func (st *Stream) remoteClose() {
+	st.m.Lock()
+	st.remoteClosed = true
+	closed := st.closed
+	st.m.Unlock()
+
+	st.notify()
+
+	if closed {
+		st.session.remove(st.id)
+	}
+}
+
+// remoteReset marks the stream reset by the remote side and removes the stream
+func (st *Stream) remoteReset() {
+	st.m.Lock()
+	st.reset = true
+	st.m.Unlock()
+
+	st.notify()
+	st.session.remove(st.id)
+}
+
+// notify wakes the pending reads and writes up
+func (st *Stream) notify() {
+	signal(st.readable)
+	signal(st.writable)
+}
+
+// signal sends a notification without blocking
+func signal(c chan struct{}) {
+	select {
+	case c <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,44 @@
+package pool
+
+import (
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStream(t *testing.T) {
+	c1, c2 := net.Pipe()
+	client := Client(c1, SessionConfig{})
+	server := Server(c2, SessionConfig{})
+	defer client.Close()
+	defer server.Close()
+
+	st, err := client.Open()
+	assert.NoError(t, err)
+	_, err = st.Write([]byte("hello"))
+	assert.NoError(t, err)
+	remote, err := server.AcceptStream()
+	assert.NoError(t, err)
+
+	// reads should fail after the deadline
+	st.SetReadDeadline(time.Now().Add(10 * time.Millisecond))
+	_, err = st.Read(make([]byte, 1))
+	assert.ErrorIs(t, err, os.ErrDeadlineExceeded)
+
+	// writes should block on the full window until the deadline
+	st.SetWriteDeadline(time.Now().Add(50 * time.Millisecond))
+	n, err := st.Write(make([]byte, 2*initialWindow))
+	assert.ErrorIs(t, err, os.ErrDeadlineExceeded)
+	assert.Equal(t, initialWindow-5, n)
+
+	// the remote side should read the data until the end of the stream
+	st.Close()
+	b := make([]byte, 5)
+	_, err = remote.Read(b)
+	assert.NoError(t, err)
+	assert.Equal(t, "hello", string(b))
+	assert.Equal(t, st.ID(), remote.ID())
+}
@@ -0,0 +1,16 @@
+package pool
+
+import (
+	"context"
+	"net"
+)
+
+// NewPool creates and returns a new pool of TCP connections to the address
+// NewPool dials with a net.Dialer so dialing is canceled with the context of Acquire
+func NewPool(address string, limit int, opts ...Option) Pool[net.Conn] {
+	dialer := &net.Dialer{}
+
+	return New(func(c context.Context) (net.Conn, error) {
+		return dialer.DialContext(c, "tcp", address)
+	}, limit, opts...)
+}
@@ -0,0 +1,82 @@
+package pubsub
+
+import (
+	"errors"
+	"sync"
+)
+
+// ErrDuplicateID is returned by Subscribe if the id is already subscribed
+var ErrDuplicateID = errors.New("id already subscribed")
+
+// subscription is the subject's tokens and the channel of a subscriber
+type subscription[E any] struct {
+	tokens []string
+	c      chan E
+}
+
+// broker routes the elements to the channels of the subscribers whose subjects match the topics of the elements
+type broker[E any] struct {
+	m             *sync.Mutex
+	subscriptions map[string]subscription[E]
+	root          *node[E]
+}
+
+// newBroker creates and returns a new broker
+func newBroker[E any]() *broker[E] {
+	return &broker[E]{
+		m:             &sync.Mutex{},
+		subscriptions: make(map[string]subscription[E]),
+		root:          newNode[E](),
+	}
+}
+
+// subscribe subscribes to the topics which match the subject
+func (b *broker[E]) subscribe(id, subject string) (chan E, error) {
+	tokens, err := tokenize(subject, true)
+	if err != nil {
+		return nil, err
+	}
+
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	if _, ok := b.subscriptions[id]; ok {
+		return nil, ErrDuplicateID
+	}
+
+	c := make(chan E)
+	b.subscriptions[id] = subscription[E]{tokens: tokens, c: c}
+	b.root.insert(tokens, id, c)
+
+	return c, nil
+}
+
+// unsubscribe removes the subscription and closes its channel
+func (b *broker[E]) unsubscribe(id string) error {
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	s, ok := b.subscriptions[id]
+	if !ok {
+		return errors.New("id not found")
+	}
+
+	delete(b.subscriptions, id)
+	b.root.remove(s.tokens, id)
+	close(s.c)
+
+	return nil
+}
+
+// publish sends the element to the subscribers whose subjects match the topic's tokens, subscribers which aren't ready miss the element
+func (b *broker[E]) publish(tokens []string, e E) {
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	b.root.match(tokens, func(c chan E) {
+		select {
+		case c <- e:
+		default:
+		}
+	})
+}
@@ -1,67 +1,133 @@
 package pubsub
 
 import (
-	"errors"
-	"sync"
+	"crypto/rand"
+	"encoding/hex"
+	"time"
 )
 
-// Pubsub defines the basic behaviors of a pubsub
-type Pubsub interface {
-	Subscribe(id string) chan string
+// Message is the envelope of a published payload
+// ID is a random id generated for each published message
+// Topic is the topic which the message is published to
+// Timestamp is the time of publishing
+// Headers are the metadata of the message, they are shared by the subscribers and shouldn't be modified
+type Message[T any] struct {
+	ID        string
+	Topic     string
+	Timestamp time.Time
+	Headers   map[string]string
+	Payload   T
+}
+
+// Pubsub defines the basic behaviors of a pubsub of typed messages
+type Pubsub[T any] interface {
+	Subscribe(id, subject string) (chan Message[T], error)
 	Unsubscribe(id string) error
-	Publish(message string)
+	Publish(topic string, payload T, headers map[string]string) (Message[T], error)
 }
 
-type pubsub struct {
-	m           *sync.Mutex
-	subscribers map[string]chan string
+// StringPubsub defines the basic behaviors of a pubsub of string messages
+type StringPubsub interface {
+	Subscribe(id, subject string) (chan string, error)
+	Unsubscribe(id string) error
+	Publish(topic, message string) error
 }
 
-// compile time proof of interface implementation
-var _ Pubsub = (*pubsub)(nil)
+type pubsub[T any] struct {
+	broker *broker[Message[T]]
+}
 
-// NewPubsub creates and returns a new pubsub
-func NewPubsub() Pubsub {
-	return &pubsub{
-		m:           &sync.Mutex{},
-		subscribers: make(map[string]chan string),
-	}
+type stringPubsub struct {
+	broker *broker[string]
 }
 
-// Subscribe subscribes to pubsub
-func (p *pubsub) Subscribe(id string) chan string {
-	c := make(chan string)
+// compile time proofs of interface implementations
+var (
+	_ Pubsub[any]  = (*pubsub[any])(nil)
+	_ StringPubsub = (*stringPubsub)(nil)
+)
 
-	p.m.Lock()
-	p.subscribers[id] = c
-	p.m.Unlock()
+// New creates and returns a new pubsub of typed messages
+func New[T any]() Pubsub[T] {
+	return &pubsub[T]{
+		broker: newBroker[Message[T]](),
+	}
+}
 
-	return c
+// Subscribe subscribes to the topics which match the subject, the subject may contain wildcards like orders.*.created and orders.>
+func (p *pubsub[T]) Subscribe(id, subject string) (chan Message[T], error) {
+	return p.broker.subscribe(id, subject)
 }
 
 // Unsubscribe unsubscribes from pubsub
-func (p *pubsub) Unsubscribe(id string) error {
-	c, ok := p.subscribers[id]
-	if !ok {
-		return errors.New("id not found")
+func (p *pubsub[T]) Unsubscribe(id string) error {
+	return p.broker.unsubscribe(id)
+}
+
+// Publish publishes the payload with a copy of the headers to the subscribers whose subjects match the topic and returns the published message.
+// The topic can't contain wildcards.
+func (p *pubsub[T]) Publish(topic string, payload T, headers map[string]string) (Message[T], error) {
+	tokens, err := tokenize(topic, false)
+	if err != nil {
+		return Message[T]{}, err
 	}
 
-	p.m.Lock()
-	delete(p.subscribers, id)
-	close(c)
-	p.m.Unlock()
+	id, err := newID()
+	if err != nil {
+		return Message[T]{}, err
+	}
 
-	return nil
+	m := Message[T]{
+		ID:        id,
+		Topic:     topic,
+		Timestamp: time.Now(),
+		Headers:   make(map[string]string, len(headers)),
+		Payload:   payload,
+	}
+	for key, value := range headers {
+		m.Headers[key] = value
+	}
+
+	p.broker.publish(tokens, m)
+
+	return m, nil
 }
 
-// Publish publishes message to the subscribers
-func (p *pubsub) Publish(message string) {
-	p.m.Lock()
-	for _, c := range p.subscribers {
-		select {
-		case c <- message:
-		default:
-		}
+// newID returns a random 128 bits id in hex
+func newID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
 	}
-	p.m.Unlock()
+
+	return hex.EncodeToString(b), nil
+}
+
+// NewPubsub creates and returns a new pubsub of string messages
+func NewPubsub() StringPubsub {
+	return &stringPubsub{
+		broker: newBroker[string](),
+	}
+}
+
+// Subscribe subscribes to the topics which match the subject, the subject may contain wildcards like orders.*.created and orders.>
+func (p *stringPubsub) Subscribe(id, subject string) (chan string, error) {
+	return p.broker.subscribe(id, subject)
+}
+
+// Unsubscribe unsubscribes from pubsub
+func (p *stringPubsub) Unsubscribe(id string) error {
+	return p.broker.unsubscribe(id)
+}
+
+// Publish publishes message to the subscribers whose subjects match the topic, the topic can't contain wildcards
+func (p *stringPubsub) Publish(topic, message string) error {
+	tokens, err := tokenize(topic, false)
+	if err != nil {
+		return err
+	}
+
+	p.broker.publish(tokens, message)
+
+	return nil
 }
@@ -3,12 +3,15 @@ package pubsub
 import (
 	"sync"
 	"testing"
+	"time"
 )
 
 func Test(t *testing.T) {
 	p := NewPubsub()
 
 	id := "id"
+	subject := "orders.>"
+	topic := "orders.created"
 	expectedMessage := "message"
 
 	wg1 := &sync.WaitGroup{}
@@ -19,7 +22,10 @@ func Test(t *testing.T) {
 	wg2.Add(1)
 	wg3.Add(1)
 	go func() {
-		c := p.Subscribe(id)
+		c, err := p.Subscribe(id, subject)
+		if err != nil {
+			t.Errorf("subscribing failed, %s", err.Error())
+		}
 		wg1.Done()
 		for message := range c {
 			if message != expectedMessage {
@@ -31,13 +37,75 @@ func Test(t *testing.T) {
 	}()
 
 	wg1.Wait()
-	p.Publish(expectedMessage)
+	err := p.Publish(topic, expectedMessage)
+	if err != nil {
+		t.Fatalf("publishing failed, %s", err.Error())
+	}
 
 	wg2.Wait()
-	err := p.Unsubscribe(id)
+	err = p.Unsubscribe(id)
 	if err != nil {
 		t.Fatalf("unsubscribing failed, %s", err.Error())
 	}
 
 	wg3.Wait()
 }
+
+func TestMessages(t *testing.T) {
+	type order struct {
+		ID     int
+		Amount float64
+	}
+
+	p := New[order]()
+
+	c, err := p.Subscribe("id", "orders.*.created")
+	if err != nil {
+		t.Fatalf("subscribing failed, %s", err.Error())
+	}
+
+	received := make(chan Message[order])
+	go func() {
+		for m := range c {
+			received <- m
+		}
+		close(received)
+	}()
+
+	// the subscriber should receive the payload in an envelope with the metadata
+	headers := map[string]string{"trace-id": "trace"}
+	var published Message[order]
+	for published.ID == "" {
+		published, err = p.Publish("orders.eu.created", order{ID: 1, Amount: 9.99}, headers)
+		if err != nil {
+			t.Fatalf("publishing failed, %s", err.Error())
+		}
+		select {
+		case m := <-received:
+			if m.ID != published.ID || m.Topic != "orders.eu.created" || m.Timestamp.IsZero() || m.Payload.ID != 1 || m.Headers["trace-id"] != "trace" {
+				t.Errorf("message doesn't match published message, %+v", m)
+			}
+		case <-time.After(10 * time.Millisecond):
+			published = Message[order]{}
+		}
+	}
+
+	// the headers should be copied
+	headers["trace-id"] = "modified"
+	if published.Headers["trace-id"] != "trace" {
+		t.Error("headers aren't copied")
+	}
+
+	// topics with wildcards should be rejected
+	_, err = p.Publish("orders.*", order{}, nil)
+	if err != ErrInvalidSubject {
+		t.Errorf("expected invalid subject error, got %v", err)
+	}
+
+	err = p.Unsubscribe("id")
+	if err != nil {
+		t.Fatalf("unsubscribing failed, %s", err.Error())
+	}
+	for range received {
+	}
+}
@@ -0,0 +1,124 @@
+package pubsub
+
+import (
+	"errors"
+	"strings"
+)
+
+// tokens of the subjects
+// subjects are the tokens separated by dots like orders.eu.created
+// the single wildcard matches one token like orders.*.created and the full wildcard matches one or more tokens at the end like orders.>
+const (
+	separator      = "."
+	singleWildcard = "*"
+	fullWildcard   = ">"
+)
+
+// ErrInvalidSubject is returned for subjects with empty tokens, misplaced full wildcards and topics with wildcards
+var ErrInvalidSubject = errors.New("invalid subject")
+
+// tokenize splits the subject into its tokens, wildcards are allowed in the subjects of the subscriptions and not in the topics of the messages
+func tokenize(subject string, wildcards bool) ([]string, error) {
+	tokens := strings.Split(subject, separator)
+
+	for i, token := range tokens {
+		switch {
+		case token == "":
+			return nil, ErrInvalidSubject
+		case token == singleWildcard && !wildcards:
+			return nil, ErrInvalidSubject
+		case token == fullWildcard && (!wildcards || i != len(tokens)-1):
+			return nil, ErrInvalidSubject
+		}
+	}
+
+	return tokens, nil
+}
+
+// node is a node of the subject trie
+// children are the nodes of the next tokens, the single wildcard is a child like the other tokens
+// subscribers are the subscribers of the subjects which end at the node
+// rest are the subscribers of the subjects which end with the full wildcard after the node
+type node[E any] struct {
+	children    map[string]*node[E]
+	subscribers map[string]chan E
+	rest        map[string]chan E
+}
+
+// newNode creates and returns a new node
+func newNode[E any]() *node[E] {
+	return &node[E]{
+		children:    make(map[string]*node[E]),
+		subscribers: make(map[string]chan E),
+		rest:        make(map[string]chan E),
+	}
+}
+
+// insert adds the subscriber of the subject's tokens
+func (n *node[E]) insert(tokens []string, id string, c chan E) {
+	for i, token := range tokens {
+		if token == fullWildcard && i == len(tokens)-1 {
+			n.rest[id] = c
+			return
+		}
+
+		child, ok := n.children[token]
+		if !ok {
+			child = newNode[E]()
+			n.children[token] = child
+		}
+		n = child
+	}
+
+	n.subscribers[id] = c
+}
+
+// remove removes the subscriber of the subject's tokens and the nodes which become empty
+func (n *node[E]) remove(tokens []string, id string) {
+	if len(tokens) == 0 {
+		delete(n.subscribers, id)
+		return
+	}
+
+	if tokens[0] == fullWildcard && len(tokens) == 1 {
+		delete(n.rest, id)
+		return
+	}
+
+	child, ok := n.children[tokens[0]]
+	if !ok {
+		return
+	}
+
+	child.remove(tokens[1:], id)
+	if child.empty() {
+		delete(n.children, tokens[0])
+	}
+}
+
+// empty reports whether the node has no subscribers and no children
+func (n *node[E]) empty() bool {
+	return len(n.children) == 0 && len(n.subscribers) == 0 && len(n.rest) == 0
+}
+
+// match calls fn with the subscribers whose subjects match the topic's tokens, match visits only the matching branches of the trie
+func (n *node[E]) match(tokens []string, fn func(c chan E)) {
+	if len(tokens) == 0 {
+		for _, c := range n.subscribers {
+			fn(c)
+		}
+		return
+	}
+
+	for _, c := range n.rest {
+		fn(c)
+	}
+
+	if child, ok := n.children[tokens[0]]; ok {
+		child.match(tokens[1:], fn)
+	}
+
+	if child, ok := n.children[singleWildcard]; ok {
+		child.match(tokens[1:], fn)
+	}
+}
@@ -0,0 +1,73 @@
+package pubsub
+
+import (
+	"testing"
+)
+
+func TestTokenize(t *testing.T) {
+	// subjects may contain wildcards, topics can't
+	cases := []struct {
+		subject   string
+		wildcards bool
+		valid     bool
+	}{
+		{"orders.created", false, true},
+		{"orders.*.created", true, true},
+		{"orders.>", true, true},
+		{"orders.*", false, false},
+		{"orders.>", false, false},
+		{"orders.>.created", true, false},
+		{"orders..created", true, false},
+		{"", true, false},
+	}
+
+	for _, c := range cases {
+		_, err := tokenize(c.subject, c.wildcards)
+		if (err == nil) != c.valid {
+			t.Errorf("tokenizing %q with wildcards %t, expected valid %t, got %v", c.subject, c.wildcards, c.valid, err)
+		}
+	}
+}
+
+func TestMatch(t *testing.T) {
+	root := newNode[string]()
+	subjects := map[string]string{
+		"exact":  "orders.eu.created",
+		"single": "orders.*.created",
+		"full":   "orders.>",
+		"other":  "payments.>",
+	}
+	for id, subject := range subjects {
+		tokens, _ := tokenize(subject, true)
+		root.insert(tokens, id, make(chan string))
+	}
+
+	// topics should match the exact subjects and the subjects with wildcards
+	cases := map[string]int{
+		"orders.eu.created": 3,
+		"orders.us.created": 2,
+		"orders.eu":         1,
+		"orders":            0,
+		"payments.failed":   1,
+		"shipments.created": 0,
+	}
+	for topic, expected := range cases {
+		tokens, _ := tokenize(topic, false)
+		matched := 0
+		root.match(tokens, func(c chan string) {
+			matched++
+		})
+		if matched != expected {
+			t.Errorf("topic %q matched %d subscribers, expected %d", topic, matched, expected)
+		}
+	}
+
+	// removing the subscribers should prune the empty nodes
+	for id, subject := range subjects {
+		tokens, _ := tokenize(subject, true)
+		root.remove(tokens, id)
+	}
+	if !root.empty() {
+		t.Error("trie isn't empty after removing all subscribers")
+	}
+}